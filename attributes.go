@@ -0,0 +1,142 @@
+package html
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//--------------------------------------------------------------------------------
+// ATTRIBUTES
+//--------------------------------------------------------------------------------
+
+// An element's attributes are kept in the order they appeared in its tag, duplicates included, with
+// `Attributes` as a map view of them holding the first value of each name (the one browsers use).
+// Changes made straight to the map are still honoured; names the list doesn't know about are rendered
+// after the others, sorted, so output is the same from run to run.
+
+var (
+	// the namespaced attributes of svg and mathml elements.
+	FOREIGN_ATTRIBUTE_NAMESPACES = map[string]string{
+		"xlink:actuate": NAMESPACE_XLINK, "xlink:arcrole": NAMESPACE_XLINK, "xlink:href": NAMESPACE_XLINK,
+		"xlink:role": NAMESPACE_XLINK, "xlink:show": NAMESPACE_XLINK, "xlink:title": NAMESPACE_XLINK,
+		"xlink:type": NAMESPACE_XLINK, "xml:lang": NAMESPACE_XML, "xml:space": NAMESPACE_XML,
+		"xmlns": NAMESPACE_XMLNS, "xmlns:xlink": NAMESPACE_XMLNS,
+	}
+)
+
+// attributeName returns the name an attribute is stored under; html names are case insensitive, and svg and
+// mathml names get the same case fixups the parser gives them, so `viewbox` and `viewBox` are both `viewBox`.
+func (e Element) attributeName(name string) string {
+	if isForeignNamespace(e.Namespace) {
+		if _, has_attr := e.Attributes[name]; has_attr {
+			return name
+		}
+		return adjustForeignAttributeName(e.Namespace, strings.ToLower(name))
+	}
+	return strings.ToLower(name)
+}
+
+// Attr returns the value of the named attribute.
+func (e Element) Attr(name string) (string, bool) {
+	value, has_attr := e.Attributes[e.attributeName(name)]
+	return value, has_attr
+}
+
+func (e Element) HasAttr(name string) bool {
+	_, has_attr := e.Attributes[e.attributeName(name)]
+	return has_attr
+}
+
+// SetAttr sets the value of the named attribute, keeping its place if it's already set and adding it
+// to the end otherwise.
+func (e *Element) SetAttr(name, value string) {
+	name = e.attributeName(name)
+	if e.Attributes == nil {
+		e.Attributes = map[string]string{}
+	}
+	e.Attributes[name] = value
+
+	for x := range e.attributeList {
+		if e.attributeList[x].Name == name {
+			e.attributeList[x].Value = value
+			e.attributeList[x].Raw = value
+			return
+		}
+	}
+	attr := Attribute{Name: name, Value: value, Raw: value, Quote: '"'}
+	if isForeignNamespace(e.Namespace) {
+		attr.Namespace = FOREIGN_ATTRIBUTE_NAMESPACES[name]
+	}
+	e.attributeList = append(e.attributeList, attr)
+}
+
+// RemoveAttr removes the named attribute, along with any duplicates of it.
+func (e *Element) RemoveAttr(name string) {
+	name = e.attributeName(name)
+	delete(e.Attributes, name)
+
+	remaining := []Attribute{}
+	for _, attr := range e.attributeList {
+		if attr.Name != name {
+			remaining = append(remaining, attr)
+		}
+	}
+	e.attributeList = remaining
+}
+
+// AttributeList returns the element's attributes in order, including any duplicates.
+func (e Element) AttributeList() []Attribute {
+	attributes := []Attribute{}
+	seen := map[string]bool{}
+	for _, attr := range e.attributeList {
+		value, has_attr := e.Attributes[attr.Name]
+		if !has_attr {
+			continue
+		}
+		if !seen[attr.Name] && value != attr.Value {
+			attr.Value = value
+			attr.Raw = value
+		}
+		seen[attr.Name] = true
+		attributes = append(attributes, attr)
+	}
+
+	unlisted := []string{}
+	for name := range e.Attributes {
+		if !seen[name] {
+			unlisted = append(unlisted, name)
+		}
+	}
+	sort.Strings(unlisted)
+	for _, name := range unlisted {
+		attributes = append(attributes, Attribute{Name: name, Value: e.Attributes[name], Raw: e.Attributes[name], Quote: '"'})
+	}
+	return attributes
+}
+
+func (e Element) findAttribute(name string) (Attribute, bool) {
+	name = e.attributeName(name)
+	for _, attr := range e.attributeList {
+		if attr.Name == name {
+			return attr, true
+		}
+	}
+	return Attribute{}, false
+}
+
+// stringifyAttributes writes attributes the way they'd appear in a tag, in their original quotes, escaping their
+// values so they can't end the quote early.
+func stringifyAttributes(attributes []Attribute) string {
+	pairs := []string{}
+	for _, attr := range attributes {
+		if len(attr.Value) == 0 {
+			pairs = append(pairs, attr.Name)
+		} else if attr.Quote == '\'' {
+			pairs = append(pairs, fmt.Sprintf("%s='%s'", attr.Name, SINGLE_QUOTE_ATTRIBUTE_ESCAPER.Replace(attr.Value)))
+		} else {
+			pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", attr.Name, ATTRIBUTE_ESCAPER.Replace(attr.Value)))
+		}
+	}
+	return strings.Join(pairs, " ")
+}
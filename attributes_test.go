@@ -0,0 +1,111 @@
+package html
+
+import (
+	"testing"
+)
+
+func TestAttributeOrder(t *testing.T) {
+	doc, parse_err := ParseFragment(`<a href="/one" class='link' data-z=1 id="a" hidden class="second">one</a>`)
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+	a := doc.Children()[0]
+
+	for x := 0; x < 10; x++ {
+		if actual := a.ToString(); actual != `<a href="/one" class='link' data-z="1" id="a" hidden class="second">` {
+			t.Errorf("attributes render as %s", actual)
+			t.FailNow()
+		}
+	}
+	if a.Attributes["class"] != "link" {
+		t.Errorf("the first of a duplicated attribute should win, found %q", a.Attributes["class"])
+	}
+
+	attributes := a.AttributeList()
+	if len(attributes) != 6 || attributes[1].Quote != '\'' || attributes[2].Quote != 0 || attributes[0].Quote != '"' {
+		t.Errorf("attribute list is %+v", attributes)
+	}
+}
+
+func TestAttributeAccessors(t *testing.T) {
+	doc, _ := ParseFragment(`<div id="main" class="a" title="x"></div>`)
+	div := doc.Children()[0]
+
+	if value, has_attr := div.Attr("ID"); !has_attr || value != "main" {
+		t.Error("Attr should find attributes regardless of case")
+	}
+	if div.HasAttr("lang") || !div.HasAttr("title") {
+		t.Error("HasAttr is wrong")
+	}
+
+	div.SetAttr("class", "b")
+	div.SetAttr("lang", "en")
+	div.RemoveAttr("title")
+	div.AddClass("c")
+	if actual := div.ToString(); actual != `<div id="main" class="b c" lang="en">` {
+		t.Errorf("changed attributes render as %s", actual)
+	}
+
+	//changes made straight to the map still show up, with new names sorted at the end.
+	div.Attributes["id"] = "other"
+	div.Attributes["z"] = "1"
+	div.Attributes["b"] = "2"
+	delete(div.Attributes, "lang")
+	if actual := div.ToString(); actual != `<div id="other" class="b c" b="2" z="1">` {
+		t.Errorf("map changes render as %s", actual)
+	}
+
+	var empty Element
+	empty.ElementName = ELEMENT_SPAN
+	empty.SetAttr("title", "new")
+	if actual := empty.ToString(); actual != `<span title="new">` {
+		t.Errorf("an element without attributes renders as %s", actual)
+	}
+
+	//values are escaped for the quote they're written in.
+	quoted, _ := ParseFragment(`<a title='it"s' href="/?a=1&amp;b=2">`)
+	link := quoted.Children()[0]
+	link.SetAttr("data-note", `a"b`)
+	if actual := link.ToString(); actual != `<a title='it"s' href="/?a=1&amp;b=2" data-note="a&quot;b">` {
+		t.Errorf("attributes with quotes render as %s", actual)
+	}
+	link.SetAttr("title", "it's")
+	if actual := link.ToString(); actual != `<a title='it&#39;s' href="/?a=1&amp;b=2" data-note="a&quot;b">` {
+		t.Errorf("a changed single quoted attribute renders as %s", actual)
+	}
+}
+
+func TestForeignAttributes(t *testing.T) {
+	doc, _ := ParseFragment(`<svg viewbox="0 0 1 1" xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="#icon"/></svg>`)
+	svg := doc.Children()[0]
+	if value, has_attr := svg.Attr("viewBox"); !has_attr || value != "0 0 1 1" {
+		t.Error("expected a camel cased viewBox")
+	}
+	if attributes := svg.AttributeList(); attributes[0].Name != "viewBox" || attributes[1].Namespace != NAMESPACE_XMLNS {
+		t.Errorf("svg attributes are %+v", attributes)
+	}
+	if attributes := svg.Children()[0].AttributeList(); len(attributes) != 1 || attributes[0].Namespace != NAMESPACE_XLINK {
+		t.Errorf("use attributes are %+v", attributes)
+	}
+
+	svg.RemoveAttr("viewBox")
+	svg.SetAttr("viewBox", "0 0 2 2")
+	svg.SetAttr("PreserveAspectRatio", "none")
+	svg.SetAttr("xlink:title", "icon")
+	if value, _ := svg.Attr("viewbox"); value != "0 0 2 2" || svg.HasAttr("viewbox") != svg.HasAttr("viewBox") {
+		t.Error("svg attribute names should be case fixed however they're written")
+	}
+	if actual := svg.ToString(); actual != `<svg xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 2 2" preserveAspectRatio="none" xlink:title="icon">` {
+		t.Errorf("set svg attributes render as %s", actual)
+	}
+	if attr, _ := svg.findAttribute("xlink:title"); attr.Namespace != NAMESPACE_XLINK {
+		t.Error("a namespaced attribute set on svg should get its namespace")
+	}
+
+	math, _ := ParseFragment(`<math></math>`)
+	math.FirstChild.SetAttr("definitionurl", "x")
+	if _, has_attr := math.FirstChild.Attributes["definitionURL"]; !has_attr {
+		t.Error("mathml attribute names should be case fixed")
+	}
+}
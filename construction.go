@@ -0,0 +1,309 @@
+package html
+
+//--------------------------------------------------------------------------------
+// TREE CONSTRUCTION
+//--------------------------------------------------------------------------------
+
+// These follow the WHATWG tree construction rules closely enough that the resulting tree matches what
+// browsers build for ordinary documents: optional end tags are implied, `<p>` is closed by block
+// elements, and html / head / body / tbody / tr are created when they're left out. Foster parenting
+// and the adoption agency algorithm are not implemented, so misnested formatting elements differ from
+// the spec: `<b><i>x</b>y</i>` is `<b><i>x</i></b>y` rather than `<b><i>x</i></b><i>y</i>`, and a second
+// `<a>` is nested in an open one instead of closing it.
+
+var (
+	// elements whose start tag closes an open `<p>`.
+	CLOSES_PARAGRAPH_ELEMENTS = map[string]bool{
+		ELEMENT_ADDRESS: true, ELEMENT_ARTICLE: true, ELEMENT_ASIDE: true, ELEMENT_BLOCKQUOTE: true,
+		"center": true, ELEMENT_DETAILS: true, ELEMENT_DIALOG: true, "dir": true, ELEMENT_DIV: true,
+		ELEMENT_DL: true, ELEMENT_FIELDSET: true, ELEMENT_FIGCAPTION: true, ELEMENT_FIGURE: true,
+		ELEMENT_FOOTER: true, ELEMENT_FORM: true, ELEMENT_HEADER: true, ELEMENT_HGROUP: true,
+		ELEMENT_HR: true, ELEMENT_MAIN: true, ELEMENT_MENU: true, ELEMENT_NAV: true, ELEMENT_OL: true,
+		ELEMENT_P: true, ELEMENT_PRE: true, "listing": true, "search": true, ELEMENT_SECTION: true,
+		ELEMENT_SUMMARY: true, ELEMENT_TABLE: true, ELEMENT_UL: true, "xmp": true, "plaintext": true,
+		ELEMENT_H1: true, ELEMENT_H2: true, ELEMENT_H3: true, ELEMENT_H4: true, ELEMENT_H5: true, ELEMENT_H6: true,
+		ELEMENT_LI: true, ELEMENT_DD: true, ELEMENT_DT: true,
+	}
+
+	// elements whose end tags may be left out; closing them implicitly isn't an error.
+	OPTIONAL_END_TAG_ELEMENTS = map[string]bool{
+		ELEMENT_DD: true, ELEMENT_DT: true, ELEMENT_LI: true, ELEMENT_OPTGROUP: true, ELEMENT_OPTION: true,
+		ELEMENT_P: true, "rb": true, ELEMENT_RP: true, ELEMENT_RT: true, ELEMENT_RTC: true,
+		ELEMENT_CAPTION: true, ELEMENT_COLGROUP: true, ELEMENT_TBODY: true, ELEMENT_TD: true,
+		ELEMENT_TFOOT: true, ELEMENT_TH: true, ELEMENT_THEAD: true, ELEMENT_TR: true,
+	}
+
+	// the parts of a table, which are dropped anywhere but inside one.
+	TABLE_PART_ELEMENTS = map[string]bool{
+		ELEMENT_CAPTION: true, ELEMENT_COL: true, ELEMENT_COLGROUP: true, ELEMENT_TBODY: true, ELEMENT_THEAD: true,
+		ELEMENT_TFOOT: true, ELEMENT_TR: true, ELEMENT_TD: true, ELEMENT_TH: true,
+	}
+
+	// elements that drop a newline straight after their start tag.
+	LEADING_NEWLINE_ELEMENTS = map[string]bool{
+		ELEMENT_PRE: true, "listing": true, ELEMENT_TEXTAREA: true,
+	}
+
+	// elements that belong in the head when they appear before the body.
+	HEAD_CONTENT_ELEMENTS = map[string]bool{
+		ELEMENT_BASE: true, "basefont": true, "bgsound": true, ELEMENT_LINK: true, ELEMENT_META: true,
+		"noframes": true, ELEMENT_NOSCRIPT: true, ELEMENT_SCRIPT: true, ELEMENT_STYLE: true,
+		ELEMENT_TEMPLATE: true, ELEMENT_TITLE: true,
+	}
+
+	// the spec's "special" category; an end tag for an ordinary element doesn't close past these.
+	SPECIAL_ELEMENTS = map[string]bool{
+		ELEMENT_ADDRESS: true, "applet": true, ELEMENT_AREA: true, ELEMENT_ARTICLE: true, ELEMENT_ASIDE: true,
+		ELEMENT_BASE: true, "basefont": true, "bgsound": true, ELEMENT_BLOCKQUOTE: true, ELEMENT_BODY: true,
+		ELEMENT_BR: true, ELEMENT_BUTTON: true, ELEMENT_CAPTION: true, "center": true, ELEMENT_COL: true,
+		ELEMENT_COLGROUP: true, ELEMENT_DD: true, ELEMENT_DETAILS: true, "dir": true, ELEMENT_DIV: true,
+		ELEMENT_DL: true, ELEMENT_DT: true, ELEMENT_EMBED: true, ELEMENT_FIELDSET: true, ELEMENT_FIGCAPTION: true,
+		ELEMENT_FIGURE: true, ELEMENT_FOOTER: true, ELEMENT_FORM: true, "frame": true, "frameset": true,
+		ELEMENT_H1: true, ELEMENT_H2: true, ELEMENT_H3: true, ELEMENT_H4: true, ELEMENT_H5: true, ELEMENT_H6: true,
+		ELEMENT_HEAD: true, ELEMENT_HEADER: true, ELEMENT_HGROUP: true, ELEMENT_HR: true, ELEMENT_HTML: true,
+		ELEMENT_IFRAME: true, ELEMENT_IMG: true, ELEMENT_INPUT: true, ELEMENT_KEYGEN: true, ELEMENT_LI: true,
+		ELEMENT_LINK: true, "listing": true, ELEMENT_MAIN: true, "marquee": true, ELEMENT_MENU: true,
+		ELEMENT_META: true, ELEMENT_NAV: true, "noembed": true, "noframes": true, ELEMENT_NOSCRIPT: true,
+		ELEMENT_OBJECT: true, ELEMENT_OL: true, ELEMENT_P: true, ELEMENT_PARAM: true, "plaintext": true,
+		ELEMENT_PRE: true, ELEMENT_SCRIPT: true, "search": true, ELEMENT_SECTION: true, ELEMENT_SELECT: true,
+		ELEMENT_SOURCE: true, ELEMENT_STYLE: true, ELEMENT_SUMMARY: true, ELEMENT_TABLE: true,
+		ELEMENT_TBODY: true, ELEMENT_TD: true, ELEMENT_TEMPLATE: true, ELEMENT_TEXTAREA: true,
+		ELEMENT_TFOOT: true, ELEMENT_TH: true, ELEMENT_THEAD: true, ELEMENT_TITLE: true, ELEMENT_TR: true,
+		ELEMENT_TRACK: true, ELEMENT_UL: true, ELEMENT_WBR: true, "xmp": true,
+	}
+
+	// the boundaries of the spec's "has an element in scope" checks.
+	SCOPE_ELEMENTS = map[string]bool{
+		"applet": true, ELEMENT_CAPTION: true, ELEMENT_HTML: true, ELEMENT_TABLE: true, ELEMENT_TD: true,
+		ELEMENT_TH: true, "marquee": true, ELEMENT_OBJECT: true, ELEMENT_TEMPLATE: true,
+		//the svg and mathml elements that hold html.
+		"foreignObject": true, "desc": true, ELEMENT_TITLE: true, "mi": true, "mo": true, "mn": true,
+		"ms": true, "mtext": true, "annotation-xml": true,
+	}
+	TABLE_SCOPE_ELEMENTS = map[string]bool{
+		ELEMENT_HTML: true, ELEMENT_TABLE: true, ELEMENT_TEMPLATE: true,
+	}
+	BUTTON_SCOPE_ELEMENTS    = scopeWith(ELEMENT_BUTTON)
+	LIST_ITEM_SCOPE_ELEMENTS = scopeWith(ELEMENT_OL, ELEMENT_UL)
+)
+
+// scopeWith returns SCOPE_ELEMENTS with `elementNames` added.
+func scopeWith(elementNames ...string) map[string]bool {
+	boundaries := map[string]bool{}
+	for name := range SCOPE_ELEMENTS {
+		boundaries[name] = true
+	}
+	for _, name := range elementNames {
+		boundaries[name] = true
+	}
+	return boundaries
+}
+
+func isHeadingElement(elementName string) bool {
+	switch elementName {
+	case ELEMENT_H1, ELEMENT_H2, ELEMENT_H3, ELEMENT_H4, ELEMENT_H5, ELEMENT_H6:
+		return true
+	}
+	return false
+}
+
+// closesElement reports whether an end tag named `closeName` closes an open `elementName`.
+func closesElement(closeName, elementName string) bool {
+	return closeName == elementName || (isHeadingElement(closeName) && isHeadingElement(elementName))
+}
+
+// findInScope returns the 1-based depth of the innermost open element matching `matches`, walking out
+// from the current node and giving up at any element in `boundaries`; 0 means it isn't in scope.
+func findInScope(names []string, matches func(string) bool, boundaries map[string]bool) int {
+	for x := len(names) - 1; x >= 0; x-- {
+		if matches(names[x]) {
+			return x + 1
+		} else if boundaries[names[x]] {
+			return 0
+		}
+	}
+	return 0
+}
+
+func isNamed(elementNames ...string) func(string) bool {
+	return func(name string) bool {
+		for _, elementName := range elementNames {
+			if name == elementName {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func paragraphInButtonScope(tagStack *elementStack) int {
+	if !tagStack.Contains(ELEMENT_P) {
+		return 0
+	}
+	return findInScope(tagStack.names, isNamed(ELEMENT_P), BUTTON_SCOPE_ELEMENTS)
+}
+
+// containsAny reports whether any of `elementNames` is open, which saves searching the stack for them when not.
+func containsAny(tagStack *elementStack, elementNames ...string) bool {
+	for _, name := range elementNames {
+		if tagStack.Contains(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// startTagClosesTo returns the depth of the outermost open element implicitly closed by the start tag
+// (or text) in `token`, given the open elements; 0 means it closes nothing.
+func startTagClosesTo(tagStack *elementStack, token Token, state *parseState) int {
+	names := tagStack.names
+	if len(names) == 0 {
+		return 0
+	}
+	current := names[len(names)-1]
+
+	if current == ELEMENT_HEAD {
+		if (token.Type == TOKEN_TEXT && !isContinuousWhitespace([]rune(token.Data))) || (isStartToken(token) && !HEAD_CONTENT_ELEMENTS[token.Name]) {
+			return len(names)
+		}
+		return 0
+	}
+	if !isStartToken(token) {
+		return 0
+	}
+
+	switch token.Name {
+	case ELEMENT_LI, ELEMENT_DD, ELEMENT_DT:
+		closes := isNamed(ELEMENT_LI)
+		if token.Name != ELEMENT_LI {
+			closes = isNamed(ELEMENT_DD, ELEMENT_DT)
+		}
+		if !containsAny(tagStack, ELEMENT_LI, ELEMENT_DD, ELEMENT_DT) {
+			break
+		}
+		for x := len(names) - 1; x >= 0; x-- {
+			if closes(names[x]) {
+				return x + 1
+			} else if SPECIAL_ELEMENTS[names[x]] && names[x] != ELEMENT_ADDRESS && names[x] != ELEMENT_DIV && names[x] != ELEMENT_P {
+				break
+			}
+		}
+	case ELEMENT_OPTION:
+		if current == ELEMENT_OPTION {
+			return len(names)
+		}
+	case ELEMENT_OPTGROUP:
+		if current == ELEMENT_OPTION || current == ELEMENT_OPTGROUP {
+			return len(names)
+		}
+	case ELEMENT_TD, ELEMENT_TH:
+		if !containsAny(tagStack, ELEMENT_TD, ELEMENT_TH) {
+			break
+		}
+		if depth := findInScope(names, isNamed(ELEMENT_TD, ELEMENT_TH), TABLE_SCOPE_ELEMENTS); depth > 0 {
+			return depth
+		}
+	case ELEMENT_TR:
+		if !tagStack.Contains(ELEMENT_TR) {
+			break
+		}
+		if depth := findInScope(names, isNamed(ELEMENT_TR), TABLE_SCOPE_ELEMENTS); depth > 0 {
+			return depth
+		}
+	case ELEMENT_THEAD, ELEMENT_TBODY, ELEMENT_TFOOT:
+		if !containsAny(tagStack, ELEMENT_THEAD, ELEMENT_TBODY, ELEMENT_TFOOT) {
+			break
+		}
+		if depth := findInScope(names, isNamed(ELEMENT_THEAD, ELEMENT_TBODY, ELEMENT_TFOOT), TABLE_SCOPE_ELEMENTS); depth > 0 {
+			return depth
+		}
+	case ELEMENT_BUTTON:
+		if !tagStack.Contains(ELEMENT_BUTTON) {
+			break
+		}
+		if depth := findInScope(names, isNamed(ELEMENT_BUTTON), SCOPE_ELEMENTS); depth > 0 {
+			return depth
+		}
+	}
+
+	//in quirks mode a table can sit inside a paragraph.
+	if CLOSES_PARAGRAPH_ELEMENTS[token.Name] && !(token.Name == ELEMENT_TABLE && state.quirksMode == QUIRKS_MODE_QUIRKS) {
+		if depth := paragraphInButtonScope(tagStack); depth > 0 {
+			return depth
+		}
+	}
+	if isHeadingElement(token.Name) && isHeadingElement(current) {
+		return len(names)
+	}
+	return 0
+}
+
+// endTagClosesTo returns the depth of the open element an end tag closes, or 0 if there isn't one for it to close.
+func endTagClosesTo(tagStack *elementStack, closeName string) int {
+	names := tagStack.names
+	if !tagStack.Contains(closeName) && !(isHeadingElement(closeName) && containsAny(tagStack, ELEMENT_H1, ELEMENT_H2, ELEMENT_H3, ELEMENT_H4, ELEMENT_H5, ELEMENT_H6)) {
+		return 0
+	} else if !SPECIAL_ELEMENTS[closeName] && !isHeadingElement(closeName) {
+		for x := len(names) - 1; x >= 0; x-- {
+			if names[x] == closeName {
+				return x + 1
+			} else if SPECIAL_ELEMENTS[names[x]] {
+				return 0
+			}
+		}
+		return 0
+	}
+
+	boundaries := SCOPE_ELEMENTS
+	switch closeName {
+	case ELEMENT_P:
+		return paragraphInButtonScope(tagStack)
+	case ELEMENT_LI:
+		boundaries = LIST_ITEM_SCOPE_ELEMENTS
+	case ELEMENT_TABLE, ELEMENT_TBODY, ELEMENT_THEAD, ELEMENT_TFOOT, ELEMENT_TR:
+		boundaries = TABLE_SCOPE_ELEMENTS
+	}
+	return findInScope(names, func(name string) bool { return closesElement(closeName, name) }, boundaries)
+}
+
+// impliedParent returns the name of an element that has to be created before `token` can be added to
+// the current node, such as the `<tbody>` around a `<tr>`, or an empty string if there isn't one.
+func impliedParent(names []string, token Token, state *parseState) string {
+	if token.Type == TOKEN_COMMENT || token.Type == TOKEN_DOCTYPE || token.Type == TOKEN_END_TAG || token.Type == TOKEN_PROCESSING_INSTRUCTION {
+		return EMPTY
+	} else if token.Type == TOKEN_TEXT && isContinuousWhitespace([]rune(token.Data)) {
+		return EMPTY
+	}
+
+	if len(names) == 0 {
+		if state.fragment || (isStartToken(token) && token.Name == ELEMENT_HTML) {
+			return EMPTY
+		}
+		return ELEMENT_HTML
+	}
+
+	switch names[len(names)-1] {
+	case ELEMENT_HTML:
+		if !state.sawHead {
+			if isStartToken(token) && token.Name == ELEMENT_HEAD {
+				return EMPTY
+			}
+			return ELEMENT_HEAD
+		} else if !isStartToken(token) || (token.Name != ELEMENT_BODY && token.Name != "frameset") {
+			return ELEMENT_BODY
+		}
+	case ELEMENT_TABLE:
+		if isStartToken(token) && (token.Name == ELEMENT_TR || token.Name == ELEMENT_TD || token.Name == ELEMENT_TH) {
+			return ELEMENT_TBODY
+		}
+	case ELEMENT_TBODY, ELEMENT_THEAD, ELEMENT_TFOOT:
+		if isStartToken(token) && (token.Name == ELEMENT_TD || token.Name == ELEMENT_TH) {
+			return ELEMENT_TR
+		}
+	}
+	return EMPTY
+}
+
+func isStartToken(token Token) bool {
+	return token.Type == TOKEN_START_TAG || token.Type == TOKEN_SELF_CLOSING_TAG
+}
@@ -0,0 +1,189 @@
+package html
+
+import (
+	"strings"
+	"testing"
+)
+
+// outline writes the element names of a tree like `ul(li(a),li(b))`, with text as its contents. Text that's
+// only whitespace is left out, so it doesn't get in the way of the structure.
+func outline(e *Element) string {
+	if e.IsText {
+		return e.Text
+	}
+	children := []string{}
+	for _, child := range e.Children() {
+		if !child.IsText || !isContinuousWhitespace([]rune(child.Text)) {
+			children = append(children, outline(child))
+		}
+	}
+	if e.IsRoot {
+		return strings.Join(children, ",")
+	} else if len(children) == 0 {
+		return e.ElementName
+	}
+	return e.ElementName + "(" + strings.Join(children, ",") + ")"
+}
+
+func TestTreeConstruction(t *testing.T) {
+	testCases := map[string]string{
+		"<ul><li>a<li>b</ul>":                              "ul(li(a),li(b))",
+		"<ul><li>a<ul><li>b</ul><li>c</ul>":                "ul(li(a,ul(li(b))),li(c))",
+		"<dl><dt>a<dd>b<dt>c</dl>":                         "dl(dt(a),dd(b),dt(c))",
+		"<p>a<div>b</div>":                                 "p(a),div(b)",
+		"<p>a<p>b":                                         "p(a),p(b)",
+		"<p>a<span>b<h1>c</h1>":                            "p(a,span(b)),h1(c)",
+		"<button><p>a<div>b</div></button>":                "button(p(a),div(b))",
+		"<h1>a<h2>b":                                       "h1(a),h2(b)",
+		"<h1>a</h2>b":                                      "h1(a),b",
+		"<select><option>a<option>b<optgroup><option>c":    "select(option(a),option(b),optgroup(option(c)))",
+		"<table><tr><td>a<td>b<tr><td>c</table>":           "table(tbody(tr(td(a),td(b)),tr(td(c))))",
+		"<table><td>a</table>":                             "table(tbody(tr(td(a))))",
+		"<table><thead><tr><th>a<tbody><tr><td>b</table>":  "table(thead(tr(th(a))),tbody(tr(td(b))))",
+		"<div><span>a</div>b":                              "div(span(a)),b",
+		"<span><div>a</span>b</div>":                       "span(div(ab))",
+		"<div>a</p>b</div>":                                "div(a,p,b)",
+		"<table><tr><td><table><tr><td>a</table>b</table>": "table(tbody(tr(td(table(tbody(tr(td(a)))),b))))",
+		"<div/>a<span/>b</div>":                            "div(a,span(b))",
+		"<br/>a<img/>b":                                    "br,a,img,b",
+		"<svg><path/>a</svg>":                              "svg(path,a)",
+		//there's no adoption agency, so misnested formatting elements are closed where they end instead of reopened.
+		"<b><i>x</b>y</i>": "b(i(x)),y",
+		"<a>1<a>2</a>":     "a(1,a(2))",
+		"<html>a":          "html(head,body(a))",
+		"<html><body>a":    "html(head,body(a))",
+	}
+
+	for input, expected := range testCases {
+		doc, parse_err := ParseFragment(input)
+		if parse_err != nil {
+			t.Errorf("%s: %s", input, parse_err.Error())
+			continue
+		}
+		if actual := outline(doc); actual != expected {
+			t.Errorf("%s parsed as %s, expected %s", input, actual, expected)
+		}
+	}
+}
+
+func TestImpliedDocumentElements(t *testing.T) {
+	testCases := map[string]string{
+		"":                                  "",
+		"text":                              "html(head,body(text))",
+		"<title>a</title><p>b":              "html(head(title(a)),body(p(b)))",
+		"<!DOCTYPE html><meta><p>a":         "doctype,html(head(meta),body(p(a)))",
+		"<html><body>a</body></html>b":      "html(head,body(ab))",
+		"<head><title>a</title></head>b":    "html(head(title(a)),body(b))",
+		"<html><head></head><body><p>a</p>": "html(head,body(p(a)))",
+		"<body><html><body>a":               "html(head,body(a))",
+		"<!-- c --><div>a</div>":            "xmlcomment,html(head,body(div(a)))",
+		"<script>1</script>":                "html(head(script(1)),body)",
+		"<html>":                            "html(head,body)",
+		"<head></head>":                     "html(head,body)",
+		"<frameset></frameset>":             "html(head,frameset)",
+	}
+
+	for input, expected := range testCases {
+		doc, parse_err := Parse(input)
+		if parse_err != nil {
+			t.Errorf("%s: %s", input, parse_err.Error())
+			continue
+		}
+		if actual := outline(doc); actual != expected {
+			t.Errorf("%q parsed as %s, expected %s", input, actual, expected)
+		}
+	}
+
+	doc, _ := Parse(SAMPLE_DOC)
+	if actual := outline(doc); !strings.HasPrefix(actual, "doctype,html(head(title(Test Document),meta,link,script(") {
+		t.Errorf("SAMPLE_DOC parsed as %s", actual)
+	}
+}
+
+func TestLeadingNewline(t *testing.T) {
+	testCases := map[string]string{
+		"<pre>\nx</pre>":                      "x",
+		"<pre>\n\nx</pre>":                    "\nx",
+		"<pre>\r\nx</pre>":                    "x",
+		"<listing>\nx</listing>":              "x",
+		"<textarea>\nx</textarea>":            "x",
+		"<pre>x\n</pre>":                      "x\n",
+		"<pre><b>b</b>\nx</pre>":              "b\nx",
+		"<div>\nx</div>":                      "\nx",
+		"<svg><textarea>\nx</textarea></svg>": "\nx",
+	}
+
+	for input, expected := range testCases {
+		doc, _ := ParseFragment(input)
+		if actual := doc.GetText(); actual != expected {
+			t.Errorf("%q has the text %q, expected %q", input, actual, expected)
+		}
+	}
+
+	doc, _ := ParseFragment("<pre>\n\nx</pre><textarea>\n\n</textarea><textarea>\n</textarea>")
+	if actual := doc.OuterHTML(); actual != "<pre>\n\nx</pre><textarea>\n\n</textarea><textarea></textarea>" {
+		t.Errorf("serialized as %q", actual)
+	}
+}
+
+func TestTreeConstructionStrict(t *testing.T) {
+	valid := []string{
+		"<ul><li>a<li>b</ul>",
+		"<table><tr><td>a<td>b</table>",
+		"<p>a<div>b</div>",
+		"<html><head><title>a</title><body><p>b</html>",
+	}
+	for _, input := range valid {
+		if _, parse_err := ParseStrict(input); parse_err != nil {
+			t.Errorf("%s: %s", input, parse_err.Error())
+		}
+	}
+
+	invalid := []string{
+		"<div><span>a</div>",
+		"<h1>a</h2>",
+		"<div>a</p></div>",
+	}
+	for _, input := range invalid {
+		if _, parse_err := ParseStrict(input); parse_err == nil {
+			t.Errorf("%s should have errored", input)
+		}
+	}
+}
+
+func TestRawTextElements(t *testing.T) {
+	doc, parse_err := ParseStrict(`<head><title>a &lt; b</title><style>div > p { color: red }</style></head><body><textarea><p>not a paragraph</textarea><p>text</p></body>`)
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+
+	expected := "html(head(title(a < b),style(div > p { color: red })),body(textarea(<p>not a paragraph),p(text)))"
+	if actual := outline(doc); actual != expected {
+		t.Errorf("parsed as %s, expected %s", actual, expected)
+	}
+}
+
+func TestDeeplyNested(t *testing.T) {
+	//every token used to rescan the open elements, so this many levels took minutes.
+	depth := 20000
+	doc, parse_err := ParseFragment(strings.Repeat("<div><span>", depth) + "<li>x</li><td>y" + strings.Repeat("</span></div>", depth))
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+
+	levels := 0
+	e := doc.FirstChild
+	for ; e != nil && !e.IsText; e = e.FirstChild {
+		levels++
+	}
+	if levels != depth*2+1 || e == nil || e.Text != "x" || e.Parent.NextSibling == nil || e.Parent.NextSibling.ElementName != ELEMENT_TD {
+		t.Errorf("nested %d levels deep", levels)
+	}
+
+	_, errors, _ := ParseWithErrors(strings.Repeat("<div>", depth))
+	if len(errors) != depth || len(errors[0].Path) != depth+2 {
+		t.Errorf("found %d unclosed elements", len(errors))
+	}
+}
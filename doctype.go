@@ -0,0 +1,220 @@
+package html
+
+import (
+	"fmt"
+	"strings"
+)
+
+//--------------------------------------------------------------------------------
+// TYPES: DOCTYPE
+//--------------------------------------------------------------------------------
+
+// Doctype is the parsed form of a `<!DOCTYPE>`. `ForceQuirks` is set when the doctype is malformed,
+// such as when it has no name, which puts the document in quirks mode regardless of the ids.
+type Doctype struct {
+	Name        string
+	PublicID    string
+	SystemID    string
+	HasPublicID bool
+	HasSystemID bool
+	ForceQuirks bool
+}
+
+func (d Doctype) String() string {
+	if len(d.Name) == 0 {
+		return "<!DOCTYPE>"
+	} else if d.HasPublicID && d.HasSystemID {
+		return fmt.Sprintf("<!DOCTYPE %s PUBLIC \"%s\" \"%s\">", d.Name, d.PublicID, d.SystemID)
+	} else if d.HasPublicID {
+		return fmt.Sprintf("<!DOCTYPE %s PUBLIC \"%s\">", d.Name, d.PublicID)
+	} else if d.HasSystemID {
+		return fmt.Sprintf("<!DOCTYPE %s SYSTEM \"%s\">", d.Name, d.SystemID)
+	}
+	return fmt.Sprintf("<!DOCTYPE %s>", d.Name)
+}
+
+// QuirksMode is the rendering mode a document puts browsers in, which is decided by its doctype.
+type QuirksMode int
+
+const (
+	QUIRKS_MODE_NO_QUIRKS QuirksMode = iota
+	QUIRKS_MODE_LIMITED_QUIRKS
+	QUIRKS_MODE_QUIRKS
+)
+
+func (qm QuirksMode) String() string {
+	switch qm {
+	case QUIRKS_MODE_NO_QUIRKS:
+		return "no-quirks"
+	case QUIRKS_MODE_LIMITED_QUIRKS:
+		return "limited-quirks"
+	case QUIRKS_MODE_QUIRKS:
+		return "quirks"
+	}
+	return "unknown"
+}
+
+var (
+	// public ids that put a document in quirks mode when they're exactly matched.
+	QUIRKS_PUBLIC_IDS = []string{
+		"-//w3o//dtd w3 html strict 3.0//en//",
+		"-/w3c/dtd html 4.0 transitional/en",
+		"html",
+	}
+
+	// public id prefixes that put a document in quirks mode.
+	QUIRKS_PUBLIC_ID_PREFIXES = []string{
+		"+//silmaril//dtd html pro v0r11 19970101//",
+		"-//as//dtd html 3.0 aswedit + extensions//",
+		"-//advasoft ltd//dtd html 3.0 aswedit + extensions//",
+		"-//ietf//dtd html 2.0 level 1//",
+		"-//ietf//dtd html 2.0 level 2//",
+		"-//ietf//dtd html 2.0 strict level 1//",
+		"-//ietf//dtd html 2.0 strict level 2//",
+		"-//ietf//dtd html 2.0 strict//",
+		"-//ietf//dtd html 2.0//",
+		"-//ietf//dtd html 2.1e//",
+		"-//ietf//dtd html 3.0//",
+		"-//ietf//dtd html 3.2 final//",
+		"-//ietf//dtd html 3.2//",
+		"-//ietf//dtd html 3//",
+		"-//ietf//dtd html level 0//",
+		"-//ietf//dtd html level 1//",
+		"-//ietf//dtd html level 2//",
+		"-//ietf//dtd html level 3//",
+		"-//ietf//dtd html strict level 0//",
+		"-//ietf//dtd html strict level 1//",
+		"-//ietf//dtd html strict level 2//",
+		"-//ietf//dtd html strict level 3//",
+		"-//ietf//dtd html strict//",
+		"-//ietf//dtd html//",
+		"-//metrius//dtd metrius presentational//",
+		"-//microsoft//dtd internet explorer 2.0 html strict//",
+		"-//microsoft//dtd internet explorer 2.0 html//",
+		"-//microsoft//dtd internet explorer 2.0 tables//",
+		"-//microsoft//dtd internet explorer 3.0 html strict//",
+		"-//microsoft//dtd internet explorer 3.0 html//",
+		"-//microsoft//dtd internet explorer 3.0 tables//",
+		"-//netscape comm. corp.//dtd html//",
+		"-//netscape comm. corp.//dtd strict html//",
+		"-//o'reilly and associates//dtd html 2.0//",
+		"-//o'reilly and associates//dtd html extended 1.0//",
+		"-//o'reilly and associates//dtd html extended relaxed 1.0//",
+		"-//sq//dtd html 2.0 hotmetal + extensions//",
+		"-//softquad software//dtd hotmetal pro 6.0::19990601::extensions to html 4.0//",
+		"-//softquad//dtd hotmetal pro 4.0::19971010::extensions to html 4.0//",
+		"-//spyglass//dtd html 2.0 extended//",
+		"-//sun microsystems corp.//dtd hotjava html//",
+		"-//sun microsystems corp.//dtd hotjava strict html//",
+		"-//w3c//dtd html 3 1995-03-24//",
+		"-//w3c//dtd html 3.2 draft//",
+		"-//w3c//dtd html 3.2 final//",
+		"-//w3c//dtd html 3.2//",
+		"-//w3c//dtd html 3.2s draft//",
+		"-//w3c//dtd html 4.0 frameset//",
+		"-//w3c//dtd html 4.0 transitional//",
+		"-//w3c//dtd html experimental 19960712//",
+		"-//w3c//dtd html experimental 970421//",
+		"-//w3c//dtd w3 html//",
+		"-//w3o//dtd w3 html 3.0//",
+		"-//webtechs//dtd mozilla html 2.0//",
+		"-//webtechs//dtd mozilla html//",
+	}
+
+	// public id prefixes that put a document in quirks mode without a system id, and limited quirks mode with one.
+	QUIRKS_HTML4_PUBLIC_ID_PREFIXES = []string{
+		"-//w3c//dtd html 4.01 frameset//",
+		"-//w3c//dtd html 4.01 transitional//",
+	}
+
+	// public id prefixes that put a document in limited quirks mode.
+	LIMITED_QUIRKS_PUBLIC_ID_PREFIXES = []string{
+		"-//w3c//dtd xhtml 1.0 frameset//",
+		"-//w3c//dtd xhtml 1.0 transitional//",
+	}
+)
+
+// QuirksMode returns the rendering mode this doctype puts a document in.
+func (d Doctype) QuirksMode() QuirksMode {
+	public_id := strings.ToLower(d.PublicID)
+	if d.ForceQuirks || d.Name != ELEMENT_HTML {
+		return QUIRKS_MODE_QUIRKS
+	}
+	if d.HasPublicID && (sliceContains(QUIRKS_PUBLIC_IDS, public_id) || hasAnyPrefix(public_id, QUIRKS_PUBLIC_ID_PREFIXES)) {
+		return QUIRKS_MODE_QUIRKS
+	}
+	if d.HasSystemID && strings.ToLower(d.SystemID) == "http://www.ibm.com/data/dtd/v11/ibmxhtml1-transitional.dtd" {
+		return QUIRKS_MODE_QUIRKS
+	}
+	if d.HasPublicID && hasAnyPrefix(public_id, QUIRKS_HTML4_PUBLIC_ID_PREFIXES) {
+		if !d.HasSystemID {
+			return QUIRKS_MODE_QUIRKS
+		}
+		return QUIRKS_MODE_LIMITED_QUIRKS
+	}
+	if d.HasPublicID && hasAnyPrefix(public_id, LIMITED_QUIRKS_PUBLIC_ID_PREFIXES) {
+		return QUIRKS_MODE_LIMITED_QUIRKS
+	}
+	return QUIRKS_MODE_NO_QUIRKS
+}
+
+// parseDoctype reads the contents of a `<!DOCTYPE ...>` (what comes after the word doctype) into its parts.
+func parseDoctype(data string) Doctype {
+	doctype := Doctype{}
+	rest := strings.TrimLeft(data, " \t\n\f\r")
+	if len(rest) == 0 {
+		doctype.ForceQuirks = true
+		return doctype
+	}
+
+	name_end := strings.IndexAny(rest, " \t\n\f\r")
+	if name_end < 0 {
+		name_end = len(rest)
+	}
+	doctype.Name = strings.ToLower(rest[:name_end])
+	rest = strings.TrimLeft(rest[name_end:], " \t\n\f\r")
+	if len(rest) == 0 {
+		return doctype
+	}
+
+	keyword := strings.ToUpper(rest)
+	var ok bool
+	if strings.HasPrefix(keyword, "PUBLIC") {
+		doctype.PublicID, rest, ok = readDoctypeIdentifier(rest[len("PUBLIC"):])
+		doctype.HasPublicID = ok
+		if ok && len(strings.TrimSpace(rest)) > 0 {
+			doctype.SystemID, rest, ok = readDoctypeIdentifier(rest)
+			doctype.HasSystemID = ok
+		}
+	} else if strings.HasPrefix(keyword, "SYSTEM") {
+		doctype.SystemID, rest, ok = readDoctypeIdentifier(rest[len("SYSTEM"):])
+		doctype.HasSystemID = ok
+	}
+	//anything else after the name, or an identifier that isn't quoted, is bogus.
+	if !ok {
+		doctype.ForceQuirks = true
+	}
+	return doctype
+}
+
+// readDoctypeIdentifier reads a quoted public or system id, returning it and what follows it.
+func readDoctypeIdentifier(text string) (string, string, bool) {
+	text = strings.TrimLeft(text, " \t\n\f\r")
+	if len(text) == 0 || (text[0] != '"' && text[0] != '\'') {
+		return EMPTY, text, false
+	}
+	end := strings.IndexByte(text[1:], text[0])
+	if end < 0 {
+		return text[1:], EMPTY, false
+	}
+	return text[1 : end+1], text[end+2:], true
+}
+
+func hasAnyPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package html
+
+import (
+	"testing"
+)
+
+func TestParseDoctype(t *testing.T) {
+	testCases := map[string]Doctype{
+		"":                                    {ForceQuirks: true},
+		"html":                                {Name: "html"},
+		"HTML":                                {Name: "html"},
+		"html SYSTEM \"about:legacy-compat\"": {Name: "html", SystemID: "about:legacy-compat", HasSystemID: true},
+		"html PUBLIC \"-//W3C//DTD HTML 4.01//EN\" 'http://www.w3.org/TR/html4/strict.dtd'": {
+			Name: "html", PublicID: "-//W3C//DTD HTML 4.01//EN", SystemID: "http://www.w3.org/TR/html4/strict.dtd", HasPublicID: true, HasSystemID: true,
+		},
+		"html PUBLIC \"\"": {Name: "html", HasPublicID: true},
+		"html bogus":       {Name: "html", ForceQuirks: true},
+		"html PUBLIC oops": {Name: "html", ForceQuirks: true},
+	}
+
+	for data, expected := range testCases {
+		if actual := parseDoctype(data); actual != expected {
+			t.Errorf("%q parsed as %+v, expected %+v", data, actual, expected)
+		}
+	}
+}
+
+func TestQuirksMode(t *testing.T) {
+	testCases := map[string]QuirksMode{
+		"<!DOCTYPE html><p>a":                           QUIRKS_MODE_NO_QUIRKS,
+		"<!-- a comment first -->\n<!doctype html><p>a": QUIRKS_MODE_NO_QUIRKS,
+		"<p>a":                QUIRKS_MODE_QUIRKS,
+		"<!DOCTYPE>":          QUIRKS_MODE_QUIRKS,
+		"<!DOCTYPE svg>":      QUIRKS_MODE_QUIRKS,
+		"<p>a<!DOCTYPE html>": QUIRKS_MODE_QUIRKS,
+		"<!DOCTYPE html PUBLIC \"-//W3C//DTD HTML 4.01//EN\">":                        QUIRKS_MODE_NO_QUIRKS,
+		"<!DOCTYPE html PUBLIC \"-//W3C//DTD HTML 4.01 Transitional//EN\">":           QUIRKS_MODE_QUIRKS,
+		"<!DOCTYPE html PUBLIC \"-//W3C//DTD HTML 4.01 Transitional//EN\" \"x.dtd\">": QUIRKS_MODE_LIMITED_QUIRKS,
+		"<!DOCTYPE html PUBLIC \"-//W3C//DTD XHTML 1.0 Transitional//EN\">":           QUIRKS_MODE_LIMITED_QUIRKS,
+		"<!DOCTYPE html PUBLIC \"-//W3C//DTD HTML 3.2 Final//EN\">":                   QUIRKS_MODE_QUIRKS,
+	}
+
+	for input, expected := range testCases {
+		doc, parse_err := Parse(input)
+		if parse_err != nil {
+			t.Errorf("%s: %s", input, parse_err.Error())
+			continue
+		}
+		if doc.QuirksMode() != expected {
+			t.Errorf("%s is in %s mode, expected %s", input, doc.QuirksMode(), expected)
+		}
+	}
+
+	//a table doesn't close an open paragraph in quirks mode.
+	doc, _ := Parse("<p>a<table><tr><td>b</table>")
+	if actual := outline(doc); actual != "html(head,body(p(a,table(tbody(tr(td(b)))))))" {
+		t.Errorf("quirks mode table parsed as %s", actual)
+	}
+	doc, _ = Parse("<!DOCTYPE html><p>a<table><tr><td>b</table>")
+	if actual := outline(doc); actual != "doctype,html(head,body(p(a),table(tbody(tr(td(b))))))" {
+		t.Errorf("no quirks mode table parsed as %s", actual)
+	}
+}
+
+func TestDoctypeNode(t *testing.T) {
+	doc, parse_err := Parse("<!DOCTYPE html PUBLIC \"-//W3C//DTD XHTML 1.0 Strict//EN\" \"http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd\"><p>a")
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+	if len(doc.Children()) == 0 || !doc.Children()[0].IsDoctype || doc.Children()[0].Doctype == nil {
+		t.Error("the first child should be the doctype")
+		t.FailNow()
+	}
+	doctype := doc.Children()[0].Doctype
+	if doctype.Name != "html" || doctype.PublicID != "-//W3C//DTD XHTML 1.0 Strict//EN" || doctype.SystemID != "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd" {
+		t.Errorf("doctype is %+v", *doctype)
+	}
+	if doc.Children()[0].ToString() != "<!DOCTYPE html PUBLIC \"-//W3C//DTD XHTML 1.0 Strict//EN\" \"http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd\">" {
+		t.Errorf("doctype renders as %s", doc.Children()[0].ToString())
+	}
+	if elems, _ := doc.QuerySelectorAll("*"); len(elems) != 4 {
+		t.Errorf("the doctype shouldn't match selectors, found %d elements", len(elems))
+	}
+}
+
+func TestCDataAndProcessingInstructions(t *testing.T) {
+	doc, parse_err := ParseFragment("<?xml version=\"1.0\"?><svg><![CDATA[a < b && c]]></svg>")
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+	if len(doc.Children()) != 2 || !doc.Children()[0].IsProcessingInstruction || doc.Children()[0].SourceHTML != "xml version=\"1.0\"" {
+		t.Error("expected a processing instruction first")
+		t.FailNow()
+	}
+	svg := doc.Children()[1]
+	if len(svg.Children()) != 1 || !svg.Children()[0].IsCData || svg.Children()[0].Text != "a < b && c" {
+		t.Error("expected the svg to hold a cdata section")
+		t.FailNow()
+	}
+	if svg.GetInnerText() != "a < b && c" {
+		t.Errorf("inner text is %q", svg.GetInnerText())
+	}
+	if doc.Children()[0].ToString() != "<?xml version=\"1.0\"?>" || svg.Children()[0].ToString() != "<![CDATA[a < b && c]]>" {
+		t.Errorf("nodes render as %s and %s", doc.Children()[0].ToString(), svg.Children()[0].ToString())
+	}
+
+	if nodes, _ := doc.QueryXpath("//processing-instruction('xml')"); len(nodes) != 1 {
+		t.Errorf("expected to find the processing instruction, found %d", len(nodes))
+	}
+	if nodes, _ := doc.QueryXpath("//processing-instruction('php')"); len(nodes) != 0 {
+		t.Errorf("expected no php instructions, found %d", len(nodes))
+	}
+}
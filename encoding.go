@@ -0,0 +1,411 @@
+package html
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+//--------------------------------------------------------------------------------
+// ENCODINGS
+//--------------------------------------------------------------------------------
+
+const (
+	ENCODING_UTF8         = "utf-8"
+	ENCODING_UTF16LE      = "utf-16le"
+	ENCODING_UTF16BE      = "utf-16be"
+	ENCODING_WINDOWS_1252 = "windows-1252"
+	ENCODING_SHIFT_JIS    = "shift_jis"
+
+	// how much of a document is searched for a `<meta>` declaring its encoding.
+	ENCODING_PRESCAN_LENGTH = 1024
+)
+
+// CharsetReader, if set, is used to transcode documents in encodings other than utf-8, utf-16, windows-1252
+// (which covers iso-8859-1 and us-ascii) and Shift_JIS. It has the same signature as `encoding/xml`'s, so something
+// like `charset.NewReaderLabel` from golang.org/x/net/html/charset can be plugged in for GBK, EUC-KR and the rest.
+var CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+
+var (
+	// maps the common labels for an encoding to its WHATWG name.
+	ENCODING_LABELS = map[string]string{
+		"utf-8": ENCODING_UTF8, "utf8": ENCODING_UTF8, "unicode-1-1-utf-8": ENCODING_UTF8,
+
+		"utf-16": ENCODING_UTF16LE, "utf-16le": ENCODING_UTF16LE, "unicode": ENCODING_UTF16LE, "ucs-2": ENCODING_UTF16LE,
+		"utf-16be": ENCODING_UTF16BE, "unicodefffe": ENCODING_UTF16BE,
+
+		"windows-1252": ENCODING_WINDOWS_1252, "cp1252": ENCODING_WINDOWS_1252, "x-cp1252": ENCODING_WINDOWS_1252,
+		"iso-8859-1": ENCODING_WINDOWS_1252, "iso8859-1": ENCODING_WINDOWS_1252, "iso_8859-1": ENCODING_WINDOWS_1252,
+		"iso_8859-1:1987": ENCODING_WINDOWS_1252, "latin1": ENCODING_WINDOWS_1252, "l1": ENCODING_WINDOWS_1252,
+		"cp819": ENCODING_WINDOWS_1252, "ibm819": ENCODING_WINDOWS_1252, "csisolatin1": ENCODING_WINDOWS_1252,
+		"iso-ir-100": ENCODING_WINDOWS_1252, "ascii": ENCODING_WINDOWS_1252, "us-ascii": ENCODING_WINDOWS_1252,
+		"ansi_x3.4-1968": ENCODING_WINDOWS_1252,
+
+		"shift_jis": ENCODING_SHIFT_JIS, "shift-jis": ENCODING_SHIFT_JIS, "sjis": ENCODING_SHIFT_JIS, "x-sjis": ENCODING_SHIFT_JIS,
+		"ms_kanji": ENCODING_SHIFT_JIS, "csshiftjis": ENCODING_SHIFT_JIS, "windows-31j": ENCODING_SHIFT_JIS, "ms932": ENCODING_SHIFT_JIS,
+		"euc-jp": "euc-jp", "x-euc-jp": "euc-jp", "iso-2022-jp": "iso-2022-jp",
+		"gbk": "gbk", "gb2312": "gbk", "x-gbk": "gbk", "gb18030": "gb18030",
+		"big5": "big5", "big5-hkscs": "big5", "euc-kr": "euc-kr", "ks_c_5601-1987": "euc-kr",
+		"iso-8859-2": "iso-8859-2", "latin2": "iso-8859-2", "iso-8859-5": "iso-8859-5", "iso-8859-7": "iso-8859-7",
+		"iso-8859-15": "iso-8859-15", "latin9": "iso-8859-15", "koi8-r": "koi8-r", "koi8-u": "koi8-u",
+		"windows-1250": "windows-1250", "windows-1251": "windows-1251", "cp1251": "windows-1251",
+		"windows-1253": "windows-1253", "windows-1254": "windows-1254", "windows-1256": "windows-1256",
+	}
+
+	// what bytes 0x80 to 0x9F mean in windows-1252; the rest of the range is the same as unicode.
+	WINDOWS_1252_HIGH_RUNES = [32]rune{
+		0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021, 0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+		0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014, 0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+	}
+)
+
+// ParseBytes parses a document in any encoding, transcoding it to utf-8 first. The encoding comes from a byte
+// order mark, the charset in `contentType` (an http Content-Type header, which can be empty) or a `<meta>` in the
+// document, in that order, and otherwise is utf-8 if the document is valid utf-8 and windows-1252 if not.
+// The name of the encoding that was used is returned with the document.
+func ParseBytes(body []byte, contentType string) (*Element, string, error) {
+	return ParseReaderWithEncoding(bytes.NewReader(body), contentType)
+}
+
+// ParseReaderWithEncoding is ParseBytes for an `io.Reader`; only the first 1024 bytes are read ahead to find the encoding.
+func ParseReaderWithEncoding(r io.Reader, contentType string) (*Element, string, error) {
+	decoded, encoding, decode_err := NewUTF8Reader(r, contentType)
+	if decode_err != nil {
+		return nil, encoding, decode_err
+	}
+	doc, parse_err := ParseReader(decoded)
+	return doc, encoding, parse_err
+}
+
+// NewUTF8Reader detects the encoding of the document read from `r` the way ParseBytes does, returning a reader
+// for the document transcoded to utf-8 along with the name of the encoding.
+func NewUTF8Reader(r io.Reader, contentType string) (io.Reader, string, error) {
+	buffered := bufio.NewReaderSize(r, ENCODING_PRESCAN_LENGTH)
+	head, peek_err := buffered.Peek(ENCODING_PRESCAN_LENGTH)
+	if peek_err != nil && peek_err != io.EOF && peek_err != bufio.ErrBufferFull {
+		return nil, EMPTY, peek_err
+	}
+
+	encoding := DetectEncoding(head, contentType)
+	switch encoding {
+	case ENCODING_UTF8:
+		if bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}) {
+			buffered.Discard(3)
+		}
+		return buffered, encoding, nil
+	case ENCODING_UTF16LE, ENCODING_UTF16BE:
+		if bytes.HasPrefix(head, []byte{0xFF, 0xFE}) || bytes.HasPrefix(head, []byte{0xFE, 0xFF}) {
+			buffered.Discard(2)
+		}
+		return &decodingReader{source: buffered, next: utf16Decoder(encoding == ENCODING_UTF16BE)}, encoding, nil
+	case ENCODING_WINDOWS_1252:
+		return &decodingReader{source: buffered, next: decodeWindows1252}, encoding, nil
+	case ENCODING_SHIFT_JIS:
+		return &decodingReader{source: buffered, next: decodeShiftJIS}, encoding, nil
+	}
+
+	if CharsetReader == nil {
+		return nil, encoding, fmt.Errorf("html: no decoder for the %s encoding (set CharsetReader to add one)", encoding)
+	}
+	decoded, charset_err := CharsetReader(encoding, buffered)
+	return decoded, encoding, charset_err
+}
+
+// DetectEncoding returns the encoding of a document from the start of it and its (possibly empty) Content-Type.
+func DetectEncoding(head []byte, contentType string) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		return ENCODING_UTF8
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return ENCODING_UTF16LE
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return ENCODING_UTF16BE
+	}
+
+	if len(contentType) > 0 {
+		if _, params, media_err := mime.ParseMediaType(contentType); media_err == nil {
+			if encoding := lookupEncoding(params["charset"]); encoding != EMPTY {
+				return encoding
+			}
+		}
+	}
+
+	if len(head) > ENCODING_PRESCAN_LENGTH {
+		head = head[:ENCODING_PRESCAN_LENGTH]
+	}
+	if encoding := prescanEncoding(head); encoding != EMPTY {
+		//a document that could be read well enough to find its meta tag can't really be utf-16.
+		if encoding == ENCODING_UTF16LE || encoding == ENCODING_UTF16BE {
+			return ENCODING_UTF8
+		}
+		return encoding
+	}
+
+	if isValidUTF8Prefix(head) {
+		return ENCODING_UTF8
+	}
+	return ENCODING_WINDOWS_1252
+}
+
+func lookupEncoding(label string) string {
+	return ENCODING_LABELS[strings.ToLower(strings.TrimSpace(label))]
+}
+
+// isValidUTF8Prefix is utf8.Valid, allowing for a character cut off at the end of the prescanned bytes.
+func isValidUTF8Prefix(head []byte) bool {
+	for cut := 0; cut < utf8.UTFMax && cut < len(head); cut++ {
+		if utf8.Valid(head[:len(head)-cut]) {
+			return cut == 0 || !utf8.FullRune(head[len(head)-cut:])
+		}
+	}
+	return utf8.Valid(head)
+}
+
+//--------------------------------------------------------------------------------
+// ENCODINGS: PRESCAN
+//--------------------------------------------------------------------------------
+
+// prescanEncoding looks for a `<meta charset>` or `<meta http-equiv="content-type">` the way browsers do
+// before they start parsing, skipping comments and other tags.
+func prescanEncoding(head []byte) string {
+	lower := bytes.ToLower(head)
+	for cursor := 0; cursor < len(head); cursor++ {
+		if head[cursor] != '<' {
+			continue
+		}
+
+		switch {
+		case bytes.HasPrefix(lower[cursor:], []byte("<!--")):
+			end := bytes.Index(head[cursor+4:], []byte("-->"))
+			if end < 0 {
+				return EMPTY
+			}
+			cursor = cursor + 4 + end + 2
+		case bytes.HasPrefix(lower[cursor:], []byte("<meta")) && cursor+5 < len(head) && (isWhitespaceByte(head[cursor+5]) || head[cursor+5] == '/'):
+			var encoding string
+			cursor, encoding = prescanMeta(head, cursor+5)
+			if encoding != EMPTY {
+				return encoding
+			}
+		case cursor+1 < len(head) && (isAsciiLetter(head[cursor+1]) || (head[cursor+1] == '/' && cursor+2 < len(head) && isAsciiLetter(head[cursor+2]))):
+			for cursor < len(head) && !isWhitespaceByte(head[cursor]) && head[cursor] != '>' {
+				cursor++
+			}
+			for {
+				var name string
+				cursor, name, _ = prescanAttribute(head, cursor)
+				if name == EMPTY {
+					break
+				}
+			}
+		case cursor+1 < len(head) && (head[cursor+1] == '!' || head[cursor+1] == '/' || head[cursor+1] == '?'):
+			for cursor < len(head) && head[cursor] != '>' {
+				cursor++
+			}
+		}
+	}
+	return EMPTY
+}
+
+// prescanMeta reads the attributes of a meta tag, returning where it ended and the encoding it declares, if any.
+func prescanMeta(head []byte, cursor int) (int, string) {
+	got_pragma := false
+	need_pragma := false
+	charset := EMPTY
+	seen := map[string]bool{}
+
+	for {
+		var name, value string
+		cursor, name, value = prescanAttribute(head, cursor)
+		if name == EMPTY {
+			break
+		} else if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		switch name {
+		case "http-equiv":
+			got_pragma = got_pragma || strings.ToLower(value) == "content-type"
+		case "content":
+			if content_charset := charsetFromContent(value); content_charset != EMPTY && charset == EMPTY {
+				charset = content_charset
+				need_pragma = true
+			}
+		case "charset":
+			charset = value
+			need_pragma = false
+		}
+	}
+
+	if need_pragma && !got_pragma {
+		return cursor, EMPTY
+	}
+	return cursor, lookupEncoding(charset)
+}
+
+// prescanAttribute reads one attribute from a tag; the name is empty once the end of the tag is reached.
+func prescanAttribute(head []byte, cursor int) (int, string, string) {
+	for cursor < len(head) && (isWhitespaceByte(head[cursor]) || head[cursor] == '/') {
+		cursor++
+	}
+	if cursor >= len(head) || head[cursor] == '>' {
+		return cursor, EMPTY, EMPTY
+	}
+
+	name_start := cursor
+	for cursor < len(head) && head[cursor] != '=' && head[cursor] != '>' && head[cursor] != '/' && !isWhitespaceByte(head[cursor]) {
+		cursor++
+	}
+	name := strings.ToLower(string(head[name_start:cursor]))
+	if cursor == name_start { //a lone `=` is part of the name.
+		cursor++
+		name = "="
+	}
+
+	for cursor < len(head) && isWhitespaceByte(head[cursor]) {
+		cursor++
+	}
+	if cursor >= len(head) || head[cursor] != '=' {
+		return cursor, name, EMPTY
+	}
+	cursor++
+	for cursor < len(head) && isWhitespaceByte(head[cursor]) {
+		cursor++
+	}
+
+	if cursor < len(head) && (head[cursor] == '"' || head[cursor] == '\'') {
+		quote := head[cursor]
+		value_end := bytes.IndexByte(head[cursor+1:], quote)
+		if value_end < 0 {
+			return len(head), name, string(head[cursor+1:])
+		}
+		return cursor + value_end + 2, name, string(head[cursor+1 : cursor+1+value_end])
+	}
+	value_start := cursor
+	for cursor < len(head) && head[cursor] != '>' && !isWhitespaceByte(head[cursor]) {
+		cursor++
+	}
+	return cursor, name, string(head[value_start:cursor])
+}
+
+// charsetFromContent pulls the charset out of a content-type like `text/html; charset=Shift_JIS`.
+func charsetFromContent(content string) string {
+	lower := strings.ToLower(content)
+	for {
+		index := strings.Index(lower, "charset")
+		if index < 0 {
+			return EMPTY
+		}
+		rest := strings.TrimLeft(lower[index+len("charset"):], " \t\n\f\r")
+		if !strings.HasPrefix(rest, "=") {
+			lower = lower[index+len("charset"):]
+			continue
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\n\f\r")
+		if strings.HasPrefix(rest, "\"") || strings.HasPrefix(rest, "'") {
+			if end := strings.IndexByte(rest[1:], rest[0]); end >= 0 {
+				return rest[1 : end+1]
+			}
+			return EMPTY
+		}
+		if end := strings.IndexAny(rest, " \t\n\f\r;"); end >= 0 {
+			return rest[:end]
+		}
+		return rest
+	}
+}
+
+func isWhitespaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+func isAsciiLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+//--------------------------------------------------------------------------------
+// ENCODINGS: DECODERS
+//--------------------------------------------------------------------------------
+
+// decodingReader transcodes its source to utf-8 a rune at a time with `next`.
+type decodingReader struct {
+	source  *bufio.Reader
+	next    func(source *bufio.Reader) (rune, error)
+	pending []byte
+	err     error
+}
+
+func (dr *decodingReader) Read(p []byte) (int, error) {
+	for len(dr.pending) < len(p) && dr.err == nil {
+		var c rune
+		c, dr.err = dr.next(dr.source)
+		if dr.err == nil {
+			dr.pending = utf8.AppendRune(dr.pending, c)
+		}
+	}
+
+	read := copy(p, dr.pending)
+	dr.pending = dr.pending[read:]
+	if len(dr.pending) == 0 && read < len(p) {
+		return read, dr.err
+	}
+	return read, nil
+}
+
+func decodeWindows1252(source *bufio.Reader) (rune, error) {
+	c, read_err := source.ReadByte()
+	if read_err != nil {
+		return 0, read_err
+	}
+	if c >= 0x80 && c <= 0x9F {
+		return WINDOWS_1252_HIGH_RUNES[c-0x80], nil
+	}
+	return rune(c), nil
+}
+
+func utf16Decoder(bigEndian bool) func(source *bufio.Reader) (rune, error) {
+	readUnit := func(source *bufio.Reader) (rune, error) {
+		var pair [2]byte
+		if _, read_err := io.ReadFull(source, pair[:]); read_err != nil {
+			if read_err == io.ErrUnexpectedEOF {
+				return utf8.RuneError, nil
+			}
+			return 0, read_err
+		}
+		if bigEndian {
+			return rune(pair[0])<<8 | rune(pair[1]), nil
+		}
+		return rune(pair[1])<<8 | rune(pair[0]), nil
+	}
+
+	return func(source *bufio.Reader) (rune, error) {
+		unit, read_err := readUnit(source)
+		if read_err != nil || !utf16.IsSurrogate(unit) {
+			return unit, read_err
+		}
+		if unit >= 0xDC00 { //a low surrogate on its own.
+			return utf8.RuneError, nil
+		}
+
+		//peek at the next unit, leaving it to be read again if it isn't the other half of the pair.
+		next, peek_err := source.Peek(2)
+		if peek_err != nil {
+			return utf8.RuneError, nil
+		}
+		low := rune(next[1])<<8 | rune(next[0])
+		if bigEndian {
+			low = rune(next[0])<<8 | rune(next[1])
+		}
+		if low < 0xDC00 || low > 0xDFFF {
+			return utf8.RuneError, nil
+		}
+		source.Discard(2)
+		return utf16.DecodeRune(unit, low), nil
+	}
+}
@@ -0,0 +1,121 @@
+package html
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	testCases := []struct {
+		head        string
+		contentType string
+		expected    string
+	}{
+		{"<p>plain ascii</p>", "", ENCODING_UTF8},
+		{"<p>caf\xc3\xa9</p>", "", ENCODING_UTF8},
+		{"<p>caf\xe9</p>", "", ENCODING_WINDOWS_1252},
+		{"\xef\xbb\xbf<p>bom</p>", "text/html; charset=windows-1252", ENCODING_UTF8},
+		{"\xff\xfe<\x00p\x00>\x00", "", ENCODING_UTF16LE},
+		{"\xfe\xff\x00<\x00p\x00>", "", ENCODING_UTF16BE},
+		{"<p>caf\xc3\xa9</p>", "text/html; charset=ISO-8859-1", ENCODING_WINDOWS_1252},
+		{"<p>x</p>", "text/html; charset=\"Shift_JIS\"", "shift_jis"},
+		{"<p>x</p>", "text/html; charset=unknown-thing", ENCODING_UTF8},
+		{`<html><head><meta charset="windows-1252">`, "", ENCODING_WINDOWS_1252},
+		{`<html><head><META CHARSET=Shift_JIS>`, "", "shift_jis"},
+		{`<meta http-equiv="Content-Type" content="text/html; charset=euc-jp">`, "", "euc-jp"},
+		{`<meta content="text/html; charset=euc-jp">`, "", ENCODING_UTF8},
+		{`<meta content='text/html; charset="gbk"' http-equiv=content-type>`, "", "gbk"},
+		{`<!-- <meta charset="gbk"> --><meta charset="big5">`, "", "big5"},
+		{`<title>x</title><div data-x="<meta charset=gbk>"><meta charset=big5>`, "", "big5"},
+		{`<meta charset="utf-16">`, "", ENCODING_UTF8},
+		{`<meta name="viewport" content="width=device-width"><meta charset="latin1">`, "", ENCODING_WINDOWS_1252},
+		{strings.Repeat(" ", 1100) + `<meta charset="gbk">`, "", ENCODING_UTF8},
+		{`<meta charset="gbk">`, "text/html", "gbk"},
+	}
+
+	for _, testCase := range testCases {
+		if actual := DetectEncoding([]byte(testCase.head), testCase.contentType); actual != testCase.expected {
+			t.Errorf("%q with %q detected as %s, expected %s", testCase.head, testCase.contentType, actual, testCase.expected)
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	windows_1252 := []byte("<html><head><meta charset=\"windows-1252\"><title>Caf\xe9 \x93quoted\x94 \x80</title></head></html>")
+	doc, encoding, parse_err := ParseBytes(windows_1252, "")
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+	if encoding != ENCODING_WINDOWS_1252 {
+		t.Errorf("encoding is %s", encoding)
+	}
+	if title, _ := doc.QuerySelector("title"); title == nil || title.GetInnerText() != "Café “quoted” €" {
+		t.Errorf("title is %q", title.GetInnerText())
+	}
+
+	latin1 := []byte("<p title=\"na\xefve\">r\xe9sum\xe9</p>")
+	doc, encoding, _ = ParseBytes(latin1, "text/html; charset=iso-8859-1")
+	if p, _ := doc.QuerySelector("p"); encoding != ENCODING_WINDOWS_1252 || p.GetInnerText() != "résumé" || p.Attributes["title"] != "naïve" {
+		t.Errorf("iso-8859-1 document parsed as %s", outline(doc))
+	}
+
+	units := utf16.Encode([]rune("<p>snowman ☃ and 𝄞</p>"))
+	utf16le := []byte{0xFF, 0xFE}
+	for _, unit := range units {
+		utf16le = append(utf16le, byte(unit), byte(unit>>8))
+	}
+	doc, encoding, _ = ParseBytes(utf16le, "")
+	if p, _ := doc.QuerySelector("p"); encoding != ENCODING_UTF16LE || p == nil || p.GetInnerText() != "snowman ☃ and 𝄞" {
+		t.Errorf("utf-16 document parsed as %s", outline(doc))
+	}
+
+	mock := readFileContents("mocks/news.ycombinator.com.html")
+	doc, encoding, _ = ParseBytes([]byte(mock), "text/html")
+	if parsed, _ := Parse(mock); !parsed.EqualTo(*doc) {
+		t.Errorf("ParseBytes and Parse disagree on a utf-8 document detected as %s", encoding)
+	}
+
+	doc, encoding, _ = ParseBytes([]byte("\xef\xbb\xbf<p>bom</p>"), "")
+	if encoding != ENCODING_UTF8 || outline(doc) != "html(head,body(p(bom)))" {
+		t.Errorf("utf-8 document with a bom parsed as %s", outline(doc))
+	}
+}
+
+func TestParseBytesShiftJIS(t *testing.T) {
+	shift_jis := []byte("<meta charset=\"Shift_JIS\"><p>\x93\xfa\x96{\x8c\xea\x82\xcc\x83e\x83X\x83g \xb1\x87@\x81`\xfa@\xf0@\x81 x\x82</p>")
+	doc, encoding, parse_err := ParseBytes(shift_jis, "")
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+	if p, _ := doc.QuerySelector("p"); encoding != ENCODING_SHIFT_JIS || p == nil || p.GetInnerText() != "日本語のテスト ｱ①〜ⅰ\ue000\ufffd x\ufffd" {
+		t.Errorf("shift_jis document parsed as %s", outline(doc))
+	}
+}
+
+func TestParseBytesCharsetReader(t *testing.T) {
+	euc_jp := []byte("<meta charset=\"EUC-JP\"><p>\xa4\xa2</p>")
+	if _, encoding, parse_err := ParseBytes(euc_jp, ""); parse_err == nil || encoding != "euc-jp" {
+		t.Error("an encoding without a decoder should error")
+	}
+
+	CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		raw, _ := ioutil.ReadAll(input)
+		return bytes.NewReader(bytes.Replace(raw, []byte("\xa4\xa2"), []byte("あ"), -1)), nil
+	}
+	defer func() { CharsetReader = nil }()
+
+	doc, encoding, parse_err := ParseBytes(euc_jp, "")
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+	if p, _ := doc.QuerySelector("p"); encoding != "euc-jp" || p.GetInnerText() != "あ" {
+		t.Errorf("euc-jp document parsed as %s", outline(doc))
+	}
+}
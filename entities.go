@@ -0,0 +1,126 @@
+package html
+
+import (
+	"strings"
+)
+
+//--------------------------------------------------------------------------------
+// CHARACTER REFERENCES
+//--------------------------------------------------------------------------------
+
+const (
+	// the longest name of an entity that can be written without its semicolon, like `middot`.
+	LEGACY_ENTITY_MAX_LENGTH = 6
+)
+
+// decodeCharacterReferences decodes the named and numeric character references in `raw` the way the html tokenizer
+// does. References to the legacy entities (like `&amp` or `&copy`) may leave off their semicolon, except inside an
+// attribute value where they're followed by `=` or an alphanumeric, so urls like `?a=1&copy=2` are left alone.
+func decodeCharacterReferences(raw string, inAttribute bool) string {
+	if !strings.Contains(raw, "&") {
+		return raw
+	}
+
+	decoded := strings.Builder{}
+	for cursor := 0; cursor < len(raw); {
+		if raw[cursor] != '&' {
+			decoded.WriteByte(raw[cursor])
+			cursor++
+			continue
+		}
+
+		reference, value := readCharacterReference(raw[cursor:], inAttribute)
+		if len(reference) == 0 {
+			decoded.WriteByte('&')
+			cursor++
+			continue
+		}
+		decoded.WriteString(value)
+		cursor = cursor + len(reference)
+	}
+	return decoded.String()
+}
+
+// readCharacterReference reads the character reference `s` starts with, returning the source of the reference
+// and what it decodes to; the reference is empty if `s` doesn't start with one.
+func readCharacterReference(s string, inAttribute bool) (string, string) {
+	if strings.HasPrefix(s, "&#") {
+		digits_start := 2
+		isDigit := isDecimalDigit
+		if len(s) > 2 && (s[2] == 'x' || s[2] == 'X') {
+			digits_start = 3
+			isDigit = func(c byte) bool { return isHexDigit(rune(c)) }
+		}
+		end := digits_start
+		for end < len(s) && isDigit(s[end]) {
+			end++
+		}
+		if end == digits_start {
+			return EMPTY, EMPTY
+		}
+		if end < len(s) && s[end] == ';' {
+			end++
+		}
+		//the standard library handles the out of range and windows-1252 replacements for us.
+		return s[:end], UnescapeString(s[:end])
+	}
+
+	name_end := 1
+	for name_end < len(s) && isAlphanumeric(s[name_end]) {
+		name_end++
+	}
+	if name_end < len(s) && s[name_end] == ';' {
+		if value, is_entity := lookupEntity(s[1 : name_end+1]); is_entity {
+			return s[:name_end+1], value
+		}
+	}
+
+	//only the legacy entities are recognized without a semicolon, matching the longest one. None is longer
+	//than 6 letters, so a long run of letters is only looked up from there.
+	longest := name_end
+	if longest > LEGACY_ENTITY_MAX_LENGTH+1 {
+		longest = LEGACY_ENTITY_MAX_LENGTH + 1
+	}
+	for end := longest; end > 2; end-- {
+		value, is_entity := lookupEntity(s[1:end])
+		if !is_entity {
+			continue
+		}
+		if inAttribute && end < len(s) && (s[end] == '=' || isAlphanumeric(s[end])) {
+			return EMPTY, EMPTY
+		}
+		return s[:end], value
+	}
+	return EMPTY, EMPTY
+}
+
+// lookupEntity returns the value of the named entity `name`, which includes its semicolon if it has one.
+//
+// The standard library doesn't export its entity table, so this leans on UnescapeString: given a complete
+// reference it returns just the value, and given anything else it returns the input or a partial match with
+// the leftover letters of the name still attached. No entity's value contains ascii letters or digits except `fj`.
+func lookupEntity(name string) (string, bool) {
+	if len(name) == 0 {
+		return EMPTY, false
+	}
+	value := UnescapeString("&" + name)
+	if value == "&"+name {
+		return EMPTY, false
+	} else if name == "fjlig;" {
+		return value, true
+	}
+	for x := 0; x < len(value); x++ {
+		if isAlphanumeric(value[x]) {
+			return EMPTY, false
+		}
+	}
+	return value, true
+}
+
+func isDecimalDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlphanumeric(c byte) bool {
+	return isDecimalDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
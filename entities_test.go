@@ -0,0 +1,89 @@
+package html
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeCharacterReferences(t *testing.T) {
+	text_cases := map[string]string{
+		"no references":           "no references",
+		"a &amp; b":               "a & b",
+		"&lt;p&gt;":               "<p>",
+		"&quot;&#x27;&#39;&apos;": `"'''`,
+		"&#65;&#x42;&#X43;":       "ABC",
+		"&#65&#x42 c":             "AB c",
+		"&copy 2024":              "© 2024",
+		"&notit; &notin;":         "¬it; ∉",
+		"&hellip; &hellip":        "… &hellip",
+		"&unknown; & &; &#; &#x;": "&unknown; & &; &#; &#x;",
+		"&#0; &#x110000; &#128;":  "� � €",
+		"&NotEqualTilde;":         "≂̸",
+		"&AMP;&ampx":              "&&x",
+		"&middotx &frac12s":       "·x ½s",
+	}
+	for raw, expected := range text_cases {
+		if actual := decodeCharacterReferences(raw, false); actual != expected {
+			t.Errorf("%q decoded as %q, expected %q", raw, actual, expected)
+		}
+	}
+
+	//a long run of letters is only looked up as far as the longest legacy entity.
+	letters := strings.Repeat("a", 100000)
+	if actual := decodeCharacterReferences("&copy"+letters, false); actual != "©"+letters {
+		t.Error("a legacy entity followed by letters should still be decoded")
+	}
+	if actual := decodeCharacterReferences("&"+letters, false); actual != "&"+letters {
+		t.Error("a run of letters that isn't an entity should be left alone")
+	}
+
+	attribute_cases := map[string]string{
+		"/search?a=1&amp;b=2": "/search?a=1&b=2",
+		"/search?a=1&copy=2":  "/search?a=1&copy=2",
+		"/search?a=1&copyx":   "/search?a=1&copyx",
+		"/search?a=1&copy;=2": "/search?a=1©=2",
+		"&copy 2024":          "© 2024",
+		"&lt":                 "<",
+	}
+	for raw, expected := range attribute_cases {
+		if actual := decodeCharacterReferences(raw, true); actual != expected {
+			t.Errorf("attribute %q decoded as %q, expected %q", raw, actual, expected)
+		}
+	}
+}
+
+func TestParseCharacterReferences(t *testing.T) {
+	doc, parse_err := Parse(`<p title="Tom &amp; Jerry">Fish &amp; chips &lt;3</p><a href="/x?a=1&amp;b=2&copy=3">link</a><textarea>&lt;b&gt;</textarea><script>a &amp;&amp; b</script>`)
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+
+	p, _ := doc.QuerySelector("p")
+	if p.GetInnerText() != "Fish & chips <3" || p.Children()[0].SourceHTML != "Fish &amp; chips &lt;3" {
+		t.Errorf("text is %q, raw %q", p.GetInnerText(), p.Children()[0].SourceHTML)
+	}
+	if p.Attributes["title"] != "Tom & Jerry" {
+		t.Errorf("title is %q", p.Attributes["title"])
+	}
+	if raw, _ := p.RawAttribute("TITLE"); raw != "Tom &amp; Jerry" {
+		t.Errorf("raw title is %q", raw)
+	}
+
+	a, _ := doc.QuerySelector("a")
+	if a.Attributes["href"] != "/x?a=1&b=2&copy=3" {
+		t.Errorf("href is %q", a.Attributes["href"])
+	}
+	if textarea, _ := doc.QuerySelector("textarea"); textarea.GetInnerText() != "<b>" {
+		t.Errorf("textarea text is %q", textarea.GetInnerText())
+	}
+	if script, _ := doc.QuerySelector("script"); script.GetInnerText() != "a &amp;&amp; b" {
+		t.Errorf("script text should not be decoded, got %q", script.GetInnerText())
+	}
+	if selected, _ := doc.QuerySelectorAll(`[title="Tom & Jerry"]`); len(selected) != 1 {
+		t.Error("attribute selectors should match decoded values")
+	}
+	if text, _ := doc.QueryXpathString("string(//p)"); text != "Fish & chips <3" {
+		t.Errorf("xpath string value is %q", text)
+	}
+}
@@ -0,0 +1,71 @@
+package html
+
+import (
+	"fmt"
+	"strings"
+)
+
+//--------------------------------------------------------------------------------
+// TYPES: PARSE ERRORS
+//--------------------------------------------------------------------------------
+
+type ParseErrorCode int
+
+const (
+	PARSE_ERROR_UNEXPECTED_CLOSE ParseErrorCode = iota + 1
+	PARSE_ERROR_EMPTY_TAG
+	PARSE_ERROR_MALFORMED_COMMENT
+	PARSE_ERROR_UNCLOSED_ELEMENT
+)
+
+func (pec ParseErrorCode) String() string {
+	switch pec {
+	case PARSE_ERROR_UNEXPECTED_CLOSE:
+		return "UnexpectedClose"
+	case PARSE_ERROR_EMPTY_TAG:
+		return "EmptyTag"
+	case PARSE_ERROR_MALFORMED_COMMENT:
+		return "MalformedComment"
+	case PARSE_ERROR_UNCLOSED_ELEMENT:
+		return "UnclosedElement"
+	}
+	return "Unknown"
+}
+
+// ParseError is a problem found in a document. `Expected` and `Actual` are tag names (set for
+// mismatched closes; an unclosed element only has `Expected`), and `Path` is the list of open element
+// names at the point of the error. Elements left open at the end of the input are reported there, each
+// at the location of its start tag.
+type ParseError struct {
+	Code     ParseErrorCode
+	Location Location
+	Expected string
+	Actual   string
+	Path     []string
+}
+
+func (pe *ParseError) Error() string {
+	var message string
+	switch pe.Code {
+	case PARSE_ERROR_UNEXPECTED_CLOSE:
+		message = fmt.Sprintf("unexpected close </%s> (expected </%s>)", pe.Actual, pe.Expected)
+	case PARSE_ERROR_EMPTY_TAG:
+		message = "Empty tag similar to `<>` or `< >` or `</>`"
+	case PARSE_ERROR_MALFORMED_COMMENT:
+		message = "Malformed XML comment"
+	case PARSE_ERROR_UNCLOSED_ELEMENT:
+		message = fmt.Sprintf("unclosed <%s> at the end of the input", pe.Expected)
+	default:
+		message = "parse error"
+	}
+
+	message = message + fmt.Sprintf(" on line: %d, column: %d", pe.Location.Line, pe.Location.Column)
+	if pe.Path != nil {
+		path := "*"
+		if len(pe.Path) > 0 {
+			path = strings.Join(pe.Path, " > ")
+		}
+		message = message + fmt.Sprintf("\ncurrent path: %s", path)
+	}
+	return message
+}
@@ -0,0 +1,149 @@
+package html
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseErrorUnexpectedClose(t *testing.T) {
+	_, parse_err := ParseStrict("<html>\n<body>\n  <div><em>text</div>\n</body></html>")
+
+	var parseError *ParseError
+	if !errors.As(parse_err, &parseError) {
+		t.Errorf("expected a *ParseError, got %v", parse_err)
+		t.FailNow()
+	}
+	if parseError.Code != PARSE_ERROR_UNEXPECTED_CLOSE {
+		t.Errorf("code is %s", parseError.Code)
+	}
+	if parseError.Expected != ELEMENT_EM || parseError.Actual != ELEMENT_DIV {
+		t.Errorf("expected/actual are %q/%q", parseError.Expected, parseError.Actual)
+	}
+	if parseError.Location != (Location{Offset: 29, Line: 3, Column: 16}) {
+		t.Errorf("location is %+v", parseError.Location)
+	}
+	if strings.Join(parseError.Path, " > ") != "html > body > div > em" {
+		t.Errorf("path is %v", parseError.Path)
+	}
+	if !strings.Contains(parseError.Error(), "current path: html > body > div > em") {
+		t.Errorf("message is %q", parseError.Error())
+	}
+}
+
+func TestParseErrorMalformedComment(t *testing.T) {
+	_, parse_err := ParseStrict("<div>\n<!-x></div>")
+
+	var parseError *ParseError
+	if !errors.As(parse_err, &parseError) || parseError.Code != PARSE_ERROR_MALFORMED_COMMENT {
+		t.Errorf("expected a malformed comment error, got %v", parse_err)
+		t.FailNow()
+	}
+	if parseError.Location.Line != 2 || parseError.Location.Column != 4 {
+		t.Errorf("location is %s", parseError.Location)
+	}
+
+	if strings.Join(parseError.Path, " > ") != "html > body > div" {
+		t.Errorf("path is %v", parseError.Path)
+	}
+
+	_, parse_err = ParseStrict("<div></></div>")
+	if !errors.As(parse_err, &parseError) || parseError.Code != PARSE_ERROR_EMPTY_TAG {
+		t.Errorf("expected an empty tag error, got %v", parse_err)
+	} else if strings.Join(parseError.Path, " > ") != "html > body > div" {
+		t.Errorf("path is %v", parseError.Path)
+	}
+
+	//browsers drop `</>` and read `<!-x>` as a comment, so only the strict parsers fail on them.
+	doc, parse_err := ParseFragment("<p>a</>b</p><!-x>hello<!->")
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+	if actual := doc.OuterHTML(); actual != "<p>ab</p><!---x-->hello<!----->" {
+		t.Errorf("parsed as %s", actual)
+	}
+}
+
+func TestParseWithErrors(t *testing.T) {
+	body := "<html><body>\n<div><em>one</div>\n<span>two</b></span>\n<!-x>\n<ul><li><b>three</ul>\n</body></html>"
+	doc, parse_errors, parse_err := ParseWithErrors(body)
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+
+	expected := []struct {
+		code ParseErrorCode
+		line int
+		path string
+	}{
+		{PARSE_ERROR_UNEXPECTED_CLOSE, 2, "html > body > div > em"},
+		{PARSE_ERROR_UNEXPECTED_CLOSE, 3, "html > body > span"},
+		{PARSE_ERROR_MALFORMED_COMMENT, 4, "html > body"},
+		{PARSE_ERROR_UNEXPECTED_CLOSE, 5, "html > body > ul > li > b"},
+	}
+	if len(parse_errors) != len(expected) {
+		t.Errorf("found %d errors, expected %d: %v", len(parse_errors), len(expected), parse_errors)
+		t.FailNow()
+	}
+	for x, parseError := range parse_errors {
+		if parseError.Code != expected[x].code || parseError.Location.Line != expected[x].line || strings.Join(parseError.Path, " > ") != expected[x].path {
+			t.Errorf("error %d is %s on line %d at %v", x, parseError.Code, parseError.Location.Line, parseError.Path)
+		}
+	}
+
+	//closing the div also closes the em inside it, so the rest of the document isn't swallowed by the em.
+	body_elem, _ := doc.QuerySelector("body")
+	if body_elem == nil || len(body_elem.Children()) != 9 || body_elem.Children()[7].ElementName != ELEMENT_UL {
+		t.Error("the tree should recover from mismatched close tags")
+		t.FailNow()
+	}
+	if em, _ := doc.QuerySelector("div > em"); em == nil || em.SourceHTML != "one" {
+		t.Error("the em should end where the div does")
+	}
+	if li, _ := doc.QuerySelector("ul > li"); li == nil || body[li.Position().Start.Offset:li.Position().End.Offset] != "<li><b>three" {
+		t.Error("the li should end where the ul does")
+	}
+
+	_, parse_errors, _ = ParseWithErrors(SAMPLE_DOC)
+	if len(parse_errors) != 0 {
+		t.Errorf("a valid document should have no errors, found %v", parse_errors)
+	}
+}
+
+func TestParseErrorUnclosedElements(t *testing.T) {
+	_, parse_errors, _ := ParseWithErrors("<div><span>x")
+	expected := []struct {
+		name     string
+		location Location
+	}{
+		{ELEMENT_DIV, Location{Offset: 0, Line: 1, Column: 1}},
+		{ELEMENT_SPAN, Location{Offset: 5, Line: 1, Column: 6}},
+	}
+	if len(parse_errors) != len(expected) {
+		t.Errorf("found %d errors, expected %d: %v", len(parse_errors), len(expected), parse_errors)
+		t.FailNow()
+	}
+	for x, parseError := range parse_errors {
+		if parseError.Code != PARSE_ERROR_UNCLOSED_ELEMENT || parseError.Expected != expected[x].name || parseError.Location != expected[x].location {
+			t.Errorf("error %d is %s for %q at %s", x, parseError.Code, parseError.Expected, parseError.Location)
+		}
+		if strings.Join(parseError.Path, " > ") != "html > body > div > span" {
+			t.Errorf("error %d path is %v", x, parseError.Path)
+		}
+	}
+	if !strings.Contains(parse_errors[0].Error(), "unclosed <div>") {
+		t.Errorf("message is %q", parse_errors[0].Error())
+	}
+
+	//elements whose end tags can be left out aren't unclosed.
+	if _, parse_errors, _ = ParseWithErrors("<ul><li>a<li>b</ul><p>c<table><tr><td>d"); len(parse_errors) != 1 || parse_errors[0].Expected != ELEMENT_TABLE {
+		t.Errorf("expected only the table to be unclosed, found %v", parse_errors)
+	}
+
+	var parseError *ParseError
+	if _, parse_err := ParseStrict("<div>\n<textarea>unclosed"); !errors.As(parse_err, &parseError) || parseError.Code != PARSE_ERROR_UNCLOSED_ELEMENT || parseError.Expected != ELEMENT_DIV {
+		t.Errorf("strict parsing should fail on an unclosed element, got %v", parse_err)
+	}
+}
@@ -0,0 +1,217 @@
+package html
+
+import (
+	"strings"
+)
+
+//--------------------------------------------------------------------------------
+// FOREIGN CONTENT
+//--------------------------------------------------------------------------------
+
+// Inline `<svg>` and `<math>` put their contents in the SVG and MathML namespaces, where names are case
+// sensitive, self-closing tags are honoured and `<style>` / `<script>` / `<title>` are ordinary elements.
+// The tokenizer lowercases every name, so the spec's case fixup tables put back the camel cased ones.
+
+const (
+	NAMESPACE_HTML   = "http://www.w3.org/1999/xhtml"
+	NAMESPACE_SVG    = "http://www.w3.org/2000/svg"
+	NAMESPACE_MATHML = "http://www.w3.org/1998/Math/MathML"
+	NAMESPACE_XLINK  = "http://www.w3.org/1999/xlink"
+	NAMESPACE_XML    = "http://www.w3.org/XML/1998/namespace"
+	NAMESPACE_XMLNS  = "http://www.w3.org/2000/xmlns/"
+
+	ELEMENT_SVG  = "svg"
+	ELEMENT_MATH = "math"
+)
+
+var (
+	// svg element names with upper case letters, keyed by their lowercased form.
+	SVG_ELEMENT_NAMES = map[string]string{
+		"altglyph": "altGlyph", "altglyphdef": "altGlyphDef", "altglyphitem": "altGlyphItem",
+		"animatecolor": "animateColor", "animatemotion": "animateMotion", "animatetransform": "animateTransform",
+		"clippath": "clipPath", "feblend": "feBlend", "fecolormatrix": "feColorMatrix",
+		"fecomponenttransfer": "feComponentTransfer", "fecomposite": "feComposite",
+		"feconvolvematrix": "feConvolveMatrix", "fediffuselighting": "feDiffuseLighting",
+		"fedisplacementmap": "feDisplacementMap", "fedistantlight": "feDistantLight",
+		"fedropshadow": "feDropShadow", "feflood": "feFlood", "fefunca": "feFuncA", "fefuncb": "feFuncB",
+		"fefuncg": "feFuncG", "fefuncr": "feFuncR", "fegaussianblur": "feGaussianBlur", "feimage": "feImage",
+		"femerge": "feMerge", "femergenode": "feMergeNode", "femorphology": "feMorphology",
+		"feoffset": "feOffset", "fepointlight": "fePointLight", "fespecularlighting": "feSpecularLighting",
+		"fespotlight": "feSpotLight", "fetile": "feTile", "feturbulence": "feTurbulence",
+		"foreignobject": "foreignObject", "glyphref": "glyphRef", "lineargradient": "linearGradient",
+		"radialgradient": "radialGradient", "textpath": "textPath",
+	}
+
+	// svg attribute names with upper case letters, keyed by their lowercased form.
+	SVG_ATTRIBUTE_NAMES = map[string]string{
+		"attributename": "attributeName", "attributetype": "attributeType", "basefrequency": "baseFrequency",
+		"baseprofile": "baseProfile", "calcmode": "calcMode", "clippathunits": "clipPathUnits",
+		"diffuseconstant": "diffuseConstant", "edgemode": "edgeMode", "filterunits": "filterUnits",
+		"glyphref": "glyphRef", "gradienttransform": "gradientTransform", "gradientunits": "gradientUnits",
+		"kernelmatrix": "kernelMatrix", "kernelunitlength": "kernelUnitLength", "keypoints": "keyPoints",
+		"keysplines": "keySplines", "keytimes": "keyTimes", "lengthadjust": "lengthAdjust",
+		"limitingconeangle": "limitingConeAngle", "markerheight": "markerHeight", "markerunits": "markerUnits",
+		"markerwidth": "markerWidth", "maskcontentunits": "maskContentUnits", "maskunits": "maskUnits",
+		"numoctaves": "numOctaves", "pathlength": "pathLength", "patterncontentunits": "patternContentUnits",
+		"patterntransform": "patternTransform", "patternunits": "patternUnits", "pointsatx": "pointsAtX",
+		"pointsaty": "pointsAtY", "pointsatz": "pointsAtZ", "preservealpha": "preserveAlpha",
+		"preserveaspectratio": "preserveAspectRatio", "primitiveunits": "primitiveUnits", "refx": "refX",
+		"refy": "refY", "repeatcount": "repeatCount", "repeatdur": "repeatDur",
+		"requiredextensions": "requiredExtensions", "requiredfeatures": "requiredFeatures",
+		"specularconstant": "specularConstant", "specularexponent": "specularExponent",
+		"spreadmethod": "spreadMethod", "startoffset": "startOffset", "stddeviation": "stdDeviation",
+		"stitchtiles": "stitchTiles", "surfacescale": "surfaceScale", "systemlanguage": "systemLanguage",
+		"tablevalues": "tableValues", "targetx": "targetX", "targety": "targetY", "textlength": "textLength",
+		"viewbox": "viewBox", "viewtarget": "viewTarget", "xchannelselector": "xChannelSelector",
+		"ychannelselector": "yChannelSelector", "zoomandpan": "zoomAndPan",
+	}
+
+	// mathml attribute names with upper case letters, keyed by their lowercased form.
+	MATHML_ATTRIBUTE_NAMES = map[string]string{
+		"definitionurl": "definitionURL",
+	}
+
+	// html start tags that can't appear in foreign content, and close it instead.
+	FOREIGN_BREAKOUT_ELEMENTS = map[string]bool{
+		ELEMENT_B: true, "big": true, ELEMENT_BLOCKQUOTE: true, ELEMENT_BODY: true, ELEMENT_BR: true,
+		"center": true, ELEMENT_CODE: true, ELEMENT_DD: true, ELEMENT_DIV: true, ELEMENT_DL: true,
+		ELEMENT_DT: true, ELEMENT_EM: true, ELEMENT_EMBED: true, ELEMENT_H1: true, ELEMENT_H2: true,
+		ELEMENT_H3: true, ELEMENT_H4: true, ELEMENT_H5: true, ELEMENT_H6: true, ELEMENT_HEAD: true,
+		ELEMENT_HR: true, ELEMENT_I: true, ELEMENT_IMG: true, ELEMENT_LI: true, "listing": true,
+		ELEMENT_MENU: true, ELEMENT_META: true, "nobr": true, ELEMENT_OL: true, ELEMENT_P: true,
+		ELEMENT_PRE: true, "ruby": true, ELEMENT_S: true, ELEMENT_SMALL: true, ELEMENT_SPAN: true,
+		ELEMENT_STRONG: true, "strike": true, ELEMENT_SUB: true, ELEMENT_SUP: true, ELEMENT_TABLE: true,
+		"tt": true, ELEMENT_U: true, ELEMENT_UL: true, ELEMENT_VAR: true,
+	}
+)
+
+func isForeignNamespace(namespace string) bool {
+	return namespace == NAMESPACE_SVG || namespace == NAMESPACE_MATHML
+}
+
+// isHTMLIntegrationPoint returns if the children of a foreign element are parsed as html again.
+func isHTMLIntegrationPoint(e Element) bool {
+	if e.Namespace == NAMESPACE_SVG {
+		return e.ElementName == "foreignObject" || e.ElementName == "desc" || e.ElementName == ELEMENT_TITLE
+	} else if e.Namespace == NAMESPACE_MATHML && e.ElementName == "annotation-xml" {
+		encoding := strings.ToLower(e.Attributes["encoding"])
+		return encoding == "text/html" || encoding == "application/xhtml+xml"
+	}
+	return false
+}
+
+// isMathMLTextIntegrationPoint returns if a mathml element holds html text, like `<mi>`.
+func isMathMLTextIntegrationPoint(e Element) bool {
+	if e.Namespace != NAMESPACE_MATHML {
+		return false
+	}
+	switch e.ElementName {
+	case "mi", "mo", "mn", "ms", "mtext":
+		return true
+	}
+	return false
+}
+
+// isForeignContent returns if a start tag named `name` inside `parent` is parsed by the foreign content rules.
+func isForeignContent(parent Element, name string) bool {
+	if !isForeignNamespace(parent.Namespace) || isHTMLIntegrationPoint(parent) {
+		return false
+	}
+	if isMathMLTextIntegrationPoint(parent) && name != "mglyph" && name != "malignmark" {
+		return false
+	}
+	if parent.Namespace == NAMESPACE_MATHML && parent.ElementName == "annotation-xml" && name == ELEMENT_SVG {
+		return false
+	}
+	return true
+}
+
+// elementNamespace returns the namespace a start tag named `name` gets when it's a child of `parent`.
+func elementNamespace(parent Element, name string) string {
+	if isForeignContent(parent, name) {
+		return parent.Namespace
+	} else if name == ELEMENT_SVG {
+		return NAMESPACE_SVG
+	} else if name == ELEMENT_MATH {
+		return NAMESPACE_MATHML
+	}
+	return NAMESPACE_HTML
+}
+
+// isForeignBreakout returns if an html start tag closes the foreign content it appears in.
+func isForeignBreakout(token Token) bool {
+	if !isStartToken(token) {
+		return false
+	} else if token.Name == "font" {
+		_, has_color := token.Attr("color")
+		_, has_face := token.Attr("face")
+		_, has_size := token.Attr("size")
+		return has_color || has_face || has_size
+	}
+	return FOREIGN_BREAKOUT_ELEMENTS[token.Name]
+}
+
+// foreignBreakoutDepth returns the depth of the outermost open foreign element a breakout start tag
+// closes, which is everything above the nearest html element or integration point.
+func foreignBreakoutDepth(tagStack *elementStack) int {
+	depth := tagStack.Count
+	for node := tagStack.Top; node != nil; node = node.Next {
+		if !isForeignNamespace(node.Value.Namespace) || isHTMLIntegrationPoint(node.Value) || isMathMLTextIntegrationPoint(node.Value) {
+			if depth == tagStack.Count {
+				return 0
+			}
+			return depth + 1
+		}
+		depth--
+	}
+	if tagStack.Count == 0 { //a fragment parsed inside foreign content has nothing to break out of.
+		return 0
+	}
+	return 1
+}
+
+// adjustForeignName returns the case fixed name of an svg element.
+func adjustForeignName(namespace, name string) string {
+	if namespace == NAMESPACE_SVG {
+		if adjusted, has_adjusted := SVG_ELEMENT_NAMES[name]; has_adjusted {
+			return adjusted
+		}
+	}
+	return name
+}
+
+// adjustForeignElement puts `elem` in `namespace`, fixing the case of its names when it's foreign. Foreign
+// elements are only void when they're self-closed, so `<svg><image></image></svg>` keeps its end tag, while
+// html ignores the self-closing flag and only the known void elements are void, so `<div/>text` holds the text.
+func adjustForeignElement(elem *Element, namespace string, selfClosing bool) {
+	elem.Namespace = namespace
+	if !isForeignNamespace(namespace) {
+		elem.IsVoid = isKnownVoidElement(elem.ElementName)
+		return
+	}
+	elem.ElementName = adjustForeignName(namespace, elem.ElementName)
+	elem.IsVoid = selfClosing
+
+	for name, value := range elem.Attributes {
+		if adjusted := adjustForeignAttributeName(namespace, name); adjusted != name {
+			delete(elem.Attributes, name)
+			elem.Attributes[adjusted] = value
+		}
+	}
+	for x, attr := range elem.attributeList {
+		elem.attributeList[x].Name = adjustForeignAttributeName(namespace, attr.Name)
+		elem.attributeList[x].Namespace = FOREIGN_ATTRIBUTE_NAMESPACES[attr.Name]
+	}
+}
+
+// adjustForeignAttributeName returns the case fixed name of a lowercased svg or mathml attribute.
+func adjustForeignAttributeName(namespace, name string) string {
+	attribute_names := SVG_ATTRIBUTE_NAMES
+	if namespace == NAMESPACE_MATHML {
+		attribute_names = MATHML_ATTRIBUTE_NAMES
+	}
+	if adjusted, has_adjusted := attribute_names[name]; has_adjusted {
+		return adjusted
+	}
+	return name
+}
@@ -0,0 +1,67 @@
+package html
+
+import (
+	"testing"
+)
+
+func TestForeignContent(t *testing.T) {
+	body := `<p>icon: <svg viewBox="0 0 10 10" xmlns="http://www.w3.org/2000/svg"><defs><linearGradient id="g" gradientUnits="userSpaceOnUse"/></defs><title>Icon</title><style>path { fill: url(#g) }</style><path d="M0 0h10"/><foreignObject><div>html</div></foreignObject></svg> after</p>`
+	doc, parse_err := ParseFragment(body)
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+	if actual := outline(doc); actual != "p(icon: ,svg(defs(linearGradient),title(Icon),style(path { fill: url(#g) }),path,foreignObject(div(html))), after)" {
+		t.Errorf("svg parsed as %s", actual)
+	}
+
+	svg, _ := doc.QuerySelector("svg")
+	if svg == nil || svg.Namespace != NAMESPACE_SVG || svg.Attributes["viewBox"] != "0 0 10 10" {
+		t.Error("the svg should keep its namespace and camel cased attributes")
+		t.FailNow()
+	}
+	if gradient, _ := doc.QuerySelector("lineargradient[gradientunits]"); gradient == nil || gradient.ElementName != "linearGradient" || !gradient.IsVoid {
+		t.Error("expected a self-closed linearGradient")
+	}
+	if div, _ := doc.QuerySelector("foreignObject div"); div == nil || div.Namespace != NAMESPACE_HTML {
+		t.Error("the contents of a foreignObject should be html")
+	}
+	if p, _ := doc.QuerySelector("p"); p == nil || p.Namespace != NAMESPACE_HTML {
+		t.Error("the paragraph should be html")
+	}
+	if actual := svg.ToString(); actual != `<svg viewBox="0 0 10 10" xmlns="http://www.w3.org/2000/svg">` {
+		t.Errorf("svg renders as %s", actual)
+	}
+}
+
+func TestForeignContentBreakout(t *testing.T) {
+	testCases := map[string]string{
+		"<svg><g><p>a</p></g></svg>":            "svg(g),p(a)",
+		"<svg><font color=red>a</font></svg>":   "svg,font(a)",
+		"<svg><font>a</font></svg>":             "svg(font(a))",
+		"<svg><desc><p>a<p>b</desc></svg>":      "svg(desc(p(a),p(b)))",
+		"<svg><image></image><circle/></svg>":   "svg(image,circle)",
+		"<math><mi>x</mi><mo>=</mo><mn>1</mn>":  "math(mi(x),mo(=),mn(1))",
+		"<math><mtext><b>a</b></mtext></math>b": "math(mtext(b(a))),b",
+		"<math><annotation-xml><svg><g/></svg>": "math(annotation-xml(svg(g)))",
+	}
+
+	for input, expected := range testCases {
+		doc, parse_err := ParseFragment(input)
+		if parse_err != nil {
+			t.Errorf("%s: %s", input, parse_err.Error())
+			continue
+		}
+		if actual := outline(doc); actual != expected {
+			t.Errorf("%s parsed as %s, expected %s", input, actual, expected)
+		}
+	}
+
+	doc, _ := ParseFragment(`<math definitionurl="x"><mi>x</mi></math>`)
+	if math, _ := doc.QuerySelector("math"); math == nil || math.Namespace != NAMESPACE_MATHML || math.Attributes["definitionURL"] != "x" {
+		t.Error("expected a mathml element with a definitionURL")
+	}
+	if mi, _ := doc.QuerySelector("mi"); mi == nil || mi.Namespace != NAMESPACE_MATHML {
+		t.Error("expected the mi to be mathml")
+	}
+}
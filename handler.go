@@ -0,0 +1,75 @@
+package html
+
+import (
+	"errors"
+)
+
+//--------------------------------------------------------------------------------
+// TYPES: HANDLER
+//--------------------------------------------------------------------------------
+
+// ErrStopParsing can be returned from any `Handler` callback to end parsing early without an error.
+var ErrStopParsing = errors.New("html: stop parsing")
+
+// Handler receives parse events from ParseWithHandler. Elements passed to `StartElement` have their
+// name and attributes but no children; void elements get an `EndElement` right after their `StartElement`.
+type Handler interface {
+	StartElement(e *Element) error
+	EndElement(e *Element) error
+	Text(text string) error
+	Comment(text string) error
+}
+
+// nodeHandler is implemented by handlers that want text and comments as positioned nodes.
+type nodeHandler interface {
+	addNode(e *Element) error
+}
+
+// treeBuilder is the `Handler` behind Parse, assembling the element tree from parse events.
+type treeBuilder struct {
+	openElements []*Element
+}
+
+func (tb *treeBuilder) current() *Element {
+	return tb.openElements[len(tb.openElements)-1]
+}
+
+func (tb *treeBuilder) StartElement(e *Element) error {
+	tb.openElements = append(tb.openElements, e)
+	return nil
+}
+
+func (tb *treeBuilder) EndElement(e *Element) error {
+	tb.openElements = tb.openElements[:len(tb.openElements)-1]
+	tb.current().AddChild(e)
+	return nil
+}
+
+func (tb *treeBuilder) Text(text string) error {
+	return tb.addNode(newTextNode(text))
+}
+
+func (tb *treeBuilder) Comment(text string) error {
+	tb.current().AddChild(newCommentNode(text))
+	return nil
+}
+
+// addNode adds a text, comment, cdata or processing instruction node. Every text node is kept, whitespace
+// included, but text that directly follows other text (as it can around a `</body>`) is joined onto it.
+func (tb *treeBuilder) addNode(e *Element) error {
+	if last := tb.current().LastChild; e.IsText && last != nil && last.IsText {
+		last.Text = last.Text + e.Text
+		last.SourceHTML = last.SourceHTML + e.SourceHTML
+		last.position.End = e.position.End
+		return nil
+	}
+	tb.current().AddChild(e)
+	return nil
+}
+
+// Finish attaches any elements left open when parsing stopped with an error.
+func (tb *treeBuilder) Finish() {
+	for len(tb.openElements) > 1 {
+		tb.EndElement(tb.current())
+	}
+}
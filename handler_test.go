@@ -0,0 +1,114 @@
+package html
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+type recordingHandler struct {
+	events []string
+}
+
+func (rh *recordingHandler) StartElement(e *Element) error {
+	rh.events = append(rh.events, "<"+e.ElementName+">")
+	return nil
+}
+
+func (rh *recordingHandler) EndElement(e *Element) error {
+	rh.events = append(rh.events, "</"+e.ElementName+">")
+	return nil
+}
+
+func (rh *recordingHandler) Text(text string) error {
+	rh.events = append(rh.events, text)
+	return nil
+}
+
+func (rh *recordingHandler) Comment(text string) error {
+	rh.events = append(rh.events, "<!--"+text+"-->")
+	return nil
+}
+
+type headHandler struct {
+	title    string
+	metas    []string
+	in_title bool
+	saw_body bool
+}
+
+func (hh *headHandler) StartElement(e *Element) error {
+	switch e.ElementName {
+	case ELEMENT_BODY:
+		hh.saw_body = true
+		return ErrStopParsing
+	case ELEMENT_TITLE:
+		hh.in_title = true
+	case ELEMENT_META:
+		hh.metas = append(hh.metas, e.Attributes["name"])
+	}
+	return nil
+}
+
+func (hh *headHandler) EndElement(e *Element) error {
+	if e.ElementName == ELEMENT_TITLE {
+		hh.in_title = false
+	}
+	return nil
+}
+
+func (hh *headHandler) Text(text string) error {
+	if hh.in_title {
+		hh.title = hh.title + text
+	}
+	return nil
+}
+
+func (hh *headHandler) Comment(text string) error {
+	return nil
+}
+
+func TestParseWithHandler(t *testing.T) {
+	handler := &recordingHandler{}
+	parse_err := ParseWithHandler(`<div class="a">one<br><!--c--><p>two</p></div>`, handler)
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+
+	expected := "<html>|<head>|</head>|<body>|<div>|one|<br>|</br>|<!--c-->|<p>|two|</p>|</div>|</body>|</html>"
+	if actual := strings.Join(handler.events, "|"); actual != expected {
+		t.Errorf("events are %s, expected %s", actual, expected)
+		t.FailNow()
+	}
+}
+
+func TestParseWithHandlerStop(t *testing.T) {
+	handler := &headHandler{}
+	parse_err := ParseWithHandler(SAMPLE_DOC, handler)
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+	if handler.title != "Test Document" {
+		t.Errorf("title is %q", handler.title)
+		t.FailNow()
+	}
+	if len(handler.metas) != 1 || handler.metas[0] != "referrer" {
+		t.Error("the meta tags in the head were not reported")
+		t.FailNow()
+	}
+
+	//the failing reader is only reached if parsing continues past the body tag.
+	reader := io.MultiReader(strings.NewReader(`<head><title>Streamed</title></head><body><p>lots of content`), &failingReader{})
+	streamed := &headHandler{}
+	parse_err = ParseReaderWithHandler(reader, streamed)
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+	if !streamed.saw_body || streamed.title != "Streamed" {
+		t.Error("ParseReaderWithHandler did not stop at the body")
+		t.FailNow()
+	}
+}
@@ -1,10 +1,13 @@
 package html
 
 import (
-	"errors"
+	"bufio"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	go_html "html"
 )
@@ -21,91 +24,461 @@ func UnescapeString(s string) string {
 	return go_html.UnescapeString(s)
 }
 
-func ParseStrict(body string) (Element, error) {
-	parentElement := Element{IsRoot: true}
-	tagStack := &elementStack{}
-	cursor := 0
-	childrenError := parseChildren(&parentElement, []rune(body), &cursor, tagStack, true)
-	return parentElement, childrenError
+func ParseStrict(body string) (*Element, error) {
+	return parseString(body, &parseState{strict: true})
+}
+
+// Parse parses a document, implying missing tags the way browsers do. The adoption agency algorithm isn't
+// supported, so misnested formatting tags like `<b><i>x</b>y</i>` build a different tree than the spec's.
+func Parse(body string) (*Element, error) {
+	return parseString(body, &parseState{})
+}
+
+// ParseStrictReader parses a document as it is read from `r`, failing on mismatched close tags and unclosed elements.
+func ParseStrictReader(r io.Reader) (*Element, error) {
+	return parseReader(r, &parseState{strict: true})
+}
+
+// ParseReader parses a document as it is read from `r`, such as an http response body, without reading it all up front.
+// Only text nodes get their SourceHTML, since keeping every element's would mean holding on to the whole input.
+func ParseReader(r io.Reader) (*Element, error) {
+	return parseReader(r, &parseState{})
+}
+
+// ParseFragment parses a snippet of html the way Parse does, but without creating the html, head and body
+// elements a full document gets when they're left out.
+func ParseFragment(body string) (*Element, error) {
+	return parseString(body, &parseState{fragment: true})
+}
+
+// ParseWithErrors parses a document the way ParseStrict does, but instead of stopping at the first problem it
+// recovers and keeps going, returning the whole tree and every problem found. The error is only for failed reads.
+func ParseWithErrors(body string) (*Element, []ParseError, error) {
+	state := &parseState{recover: true}
+	doc, parse_err := parseString(body, state)
+	return doc, state.errors, parse_err
+}
+
+// ParseReaderWithErrors is ParseWithErrors for an `io.Reader`.
+func ParseReaderWithErrors(r io.Reader) (*Element, []ParseError, error) {
+	state := &parseState{recover: true}
+	doc, parse_err := parseReader(r, state)
+	return doc, state.errors, parse_err
 }
 
-func Parse(body string) (Element, error) {
-	parentElement := Element{IsRoot: true}
+// parseString parses `body` with its source kept, so elements' SourceHTML can be sliced out of it without copying.
+func parseString(body string, state *parseState) (*Element, error) {
+	state.source, state.hasSource = body, true
+	return parseReader(strings.NewReader(body), state)
+}
+
+func parseReader(r io.Reader, state *parseState) (*Element, error) {
+	parentElement := &Element{IsRoot: true, position: Position{Start: Location{Line: 1, Column: 1}}}
 	tagStack := &elementStack{}
-	cursor := 0
-	childrenError := parseChildren(&parentElement, []rune(body), &cursor, tagStack, false)
+	tokenizer := NewTokenizer(r)
+	builder := &treeBuilder{openElements: []*Element{parentElement}}
+	childrenError := parseChildren(parentElement, tokenizer, tagStack, state, builder)
+	builder.Finish()
+	parentElement.quirksMode = state.quirksMode
 	return parentElement, childrenError
 }
 
-func parseChildren(parentElement *Element, body []rune, cursor *int, tagStack *elementStack, shouldCheckElementStack bool) error {
-	if len(body) == 0 {
+// ParseWithHandler parses a document, calling `handler` as elements are read instead of building a tree.
+func ParseWithHandler(body string, handler Handler) error {
+	return ParseReaderWithHandler(strings.NewReader(body), handler)
+}
+
+// ParseReaderWithHandler is ParseWithHandler for an `io.Reader`; nothing past the point the handler stops at is read.
+func ParseReaderWithHandler(r io.Reader, handler Handler) error {
+	parentElement := Element{IsRoot: true, position: Position{Start: Location{Line: 1, Column: 1}}}
+	parse_err := parseChildren(&parentElement, NewTokenizer(r), &elementStack{}, &parseState{}, handler)
+	if parse_err == ErrStopParsing {
 		return nil
 	}
+	return parse_err
+}
+
+// parseState is shared by every level of parseChildren. `strict` fails on mismatched close tags, while `recover`
+// records problems in `errors` and carries on. `closeDepth` is set while a tag is closing open elements: every
+// level at least that deep hands the token back to its parent and returns. `source` is the whole input when
+// `hasSource` is set, which is only the case when parsing from a string. `baseDepth` is how many of the open
+// elements are the context a fragment is parsed in, which nothing in the fragment can close.
+type parseState struct {
+	strict     bool
+	recover    bool
+	fragment   bool
+	sawHead    bool
+	sawBody    bool
+	sawDoctype bool
+	quirksMode QuirksMode
+	closeDepth int
+	sawEOF     bool
+	baseDepth  int
+	source     string
+	hasSource  bool
+	errors     []ParseError
+}
+
+// closable returns `depth`, or 0 if closing to it would close the context a fragment is parsed in.
+func (ps *parseState) closable(depth int) int {
+	if depth <= ps.baseDepth {
+		return 0
+	}
+	return depth
+}
+
+// report handles a problem with the document, returning it if parsing should stop.
+func (ps *parseState) report(parse_error *ParseError) error {
+	if ps.strict {
+		return parse_error
+	} else if ps.recover {
+		ps.errors = append(ps.errors, *parse_error)
+	}
+	return nil
+}
+
+// parseChildren reads the contents of `parentElement`, whose start tag has already been read. Until the element is
+// closed, its position's End is where its start tag ended, which is where its inner html begins.
+func parseChildren(parentElement *Element, tokenizer *Tokenizer, tagStack *elementStack, state *parseState, handler Handler) error {
+	parse_start := parentElement.position.End.Offset
+	is_ended := false
+
+	end_element := func(end Location, inner_end int) {
+		parentElement.position.End = end
+		if state.hasSource && parse_start <= inner_end && inner_end <= len(state.source) {
+			parentElement.SourceHTML = state.source[parse_start:inner_end]
+		}
+	}
+	//hand the token back so the level above sees it once this element is closed.
+	unread := func(token Token) {
+		tokenizer.pending = append([]Token{token}, tokenizer.pending...)
+		end_element(token.Start, token.Start.Offset)
+	}
+
+	//a newline straight after the start tag of these is dropped, so it can be left for the markup's sake.
+	drop_newline := !parentElement.IsRoot && !isForeignNamespace(parentElement.Namespace) && LEADING_NEWLINE_ELEMENTS[parentElement.ElementName]
+
+	for {
+		token, token_err := tokenizer.Next()
+		if token_err == io.EOF {
+			if !state.sawEOF {
+				state.sawEOF = true
+				if report_err := reportUnclosed(tagStack, state); report_err != nil {
+					return report_err
+				}
+			}
+			//a document that ends before its body still gets one, after a head if that's missing too.
+			if !parentElement.IsRoot && parentElement.ElementName == ELEMENT_HTML && !isForeignNamespace(parentElement.Namespace) && !state.sawBody {
+				if handler_err := impliedAtEOF(parentElement, tokenizer.scanner.Location(), state, handler); handler_err != nil {
+					return handler_err
+				}
+			}
+			break
+		} else if token_err != nil {
+			if parse_error, is_parse_error := token_err.(*ParseError); is_parse_error {
+				if state.strict || state.recover {
+					parse_error.Path = tagStack.Names()
+				}
+				if report_err := state.report(parse_error); report_err != nil {
+					return report_err
+				}
+				continue
+			}
+			return token_err
+		}
 
-	parse_start := *cursor
-	for *cursor < len(body) {
-		results, results_err := readUntilTag(body, cursor)
-		if results_err != nil {
-			return results_err
+		open_names := tagStack.names
+		if state.closeDepth > 0 && tagStack.Count >= state.closeDepth {
+			unread(token)
+			return nil
+		}
+		state.closeDepth = 0
+
+		if drop_newline {
+			drop_newline = false
+			if token.Type == TOKEN_TEXT {
+				token.Data = strings.TrimPrefix(strings.TrimPrefix(token.Data, "\r"), "\n")
+				if len(token.Data) == 0 {
+					continue
+				}
+			}
+		}
+
+		if !state.sawDoctype && !state.fragment {
+			//the doctype has to come before anything else in the document, or there isn't one and it's in quirks mode.
+			if token.Type == TOKEN_DOCTYPE && len(open_names) == 0 {
+				doctype := parseDoctype(token.Data)
+				state.quirksMode = doctype.QuirksMode()
+				state.sawDoctype = true
+			} else if token.Type != TOKEN_COMMENT && token.Type != TOKEN_PROCESSING_INSTRUCTION && (token.Type != TOKEN_TEXT || !isContinuousWhitespace([]rune(token.Data))) {
+				state.quirksMode = QUIRKS_MODE_QUIRKS
+				state.sawDoctype = true
+			}
+		}
+
+		in_foreign_content := isStartToken(token) && isForeignContent(*parentElement, token.Name)
+		if in_foreign_content && isForeignBreakout(token) {
+			if close_depth := state.closable(foreignBreakoutDepth(tagStack)); close_depth > 0 {
+				state.closeDepth = close_depth
+				unread(token)
+				return nil
+			}
+		} else if token.Type != TOKEN_END_TAG && !in_foreign_content {
+			if close_depth := startTagClosesTo(tagStack, token, state); state.closable(close_depth) > 0 {
+				state.closeDepth = close_depth
+				unread(token)
+				return nil
+			} else if close_depth > 0 && TABLE_PART_ELEMENTS[token.Name] {
+				//a cell or row that would close the context a fragment is parsed in is dropped.
+				continue
+			}
+			if implied_name := impliedParent(open_names, token, state); implied_name != EMPTY {
+				tokenizer.pending = append([]Token{token}, tokenizer.pending...)
+				token = Token{Type: TOKEN_START_TAG, Name: implied_name, Start: token.Start, End: token.Start}
+			}
 		}
 
-		if len(results) > 0 && !isContinuousWhitespace(results) {
-			new_text_node := newTextNode(results)
-			parentElement.AddChild(new_text_node)
+		if node_handler, is_node_handler := handler.(nodeHandler); is_node_handler && (token.Type == TOKEN_TEXT || token.Type == TOKEN_COMMENT || token.Type == TOKEN_CDATA || token.Type == TOKEN_PROCESSING_INSTRUCTION) {
+			if handler_err := node_handler.addNode(newElementFromToken(token)); handler_err != nil {
+				return handler_err
+			}
+			continue
 		}
 
-		read_tag, read_tag_error := readTag(body, cursor)
-		if read_tag_error != nil {
-			return read_tag_error
+		switch token.Type {
+		case TOKEN_TEXT:
+			if handler_err := handler.Text(token.Data); handler_err != nil {
+				return handler_err
+			}
+			continue
+		case TOKEN_COMMENT:
+			if handler_err := handler.Comment(token.Data); handler_err != nil {
+				return handler_err
+			}
+			continue
+		case TOKEN_CDATA:
+			if handler_err := handler.Text(token.Data); handler_err != nil {
+				return handler_err
+			}
+			continue
+		case TOKEN_PROCESSING_INSTRUCTION:
+			continue
 		}
 
+		read_tag := newElementFromToken(token)
+		if read_tag.IsClose && isForeignNamespace(parentElement.Namespace) {
+			read_tag.ElementName = adjustForeignName(parentElement.Namespace, read_tag.ElementName)
+		} else if !read_tag.IsClose && !read_tag.IsDoctype {
+			namespace := elementNamespace(*parentElement, read_tag.ElementName)
+			adjustForeignElement(read_tag, namespace, token.Type == TOKEN_SELF_CLOSING_TAG)
+			if isForeignNamespace(namespace) {
+				tokenizer.rawText = EMPTY //style, script and title aren't raw text in svg or mathml.
+			}
+		}
 		if read_tag.IsClose {
-			expected_tag := tagStack.Peek()
+			expected_name := EMPTY
+			if expected_tag := tagStack.Peek(); expected_tag != nil {
+				expected_name = expected_tag.ElementName
+			}
+			//the path is only copied off the stack when the error is kept.
+			report_close := func() error {
+				if !state.strict && !state.recover {
+					return nil
+				}
+				return state.report(&ParseError{
+					Code:     PARSE_ERROR_UNEXPECTED_CLOSE,
+					Location: token.Start,
+					Expected: expected_name,
+					Actual:   read_tag.ElementName,
+					Path:     tagStack.Names(),
+				})
+			}
 
-			if expected_tag.ElementName == read_tag.ElementName {
-				tagStack.Pop()
-				parentElement.InnerHTML = string(body[parse_start:*cursor])
-				return nil
-			} else if shouldCheckElementStack {
-				error_text := fmt.Sprintf("unexpected close </%s> (expected </%s>) on line: %d", read_tag.ElementName, expected_tag.ElementName, countNewlinesBefore(string(body), *cursor))
-				error_text = error_text + fmt.Sprintf("\ncurrent path: %s", tagStack.ToString())
-				return errors.New(error_text)
+			//the body and html stay open until the end of the input, so anything after their end tags still lands in the body.
+			if (read_tag.ElementName == ELEMENT_BODY || read_tag.ElementName == ELEMENT_HTML) && tagStack.Contains(read_tag.ElementName) {
+				if expected_name == ELEMENT_BODY || expected_name == ELEMENT_HTML {
+					if !is_ended {
+						end_element(token.End, token.Start.Offset)
+						is_ended = true
+					}
+					continue
+				}
+				read_tag.ElementName = ELEMENT_BODY
+				if !tagStack.Contains(ELEMENT_BODY) {
+					read_tag.ElementName = ELEMENT_HTML
+				}
 			}
 
-		} else if read_tag.IsVoid {
-			parentElement.AddChild(read_tag)
-		} else if read_tag.ElementName == "script" { //script tags are a black hole of misery and pain.
-			script_type := "text/javascript"
-			tag_script_type, has_script_type := read_tag.Attributes["type"]
+			close_depth := state.closable(endTagClosesTo(tagStack, read_tag.ElementName))
+			if close_depth == len(open_names) && close_depth > 0 {
+				if expected_name != read_tag.ElementName {
+					if report_err := report_close(); report_err != nil {
+						return report_err
+					}
+				}
+				end_element(token.End, token.Start.Offset)
+				return nil
+			} else if close_depth > 0 {
+				//the elements between here and the one being closed are closed with it, which is only fine if their end tags are optional.
+				for _, open_name := range open_names[close_depth:] {
+					if !OPTIONAL_END_TAG_ELEMENTS[open_name] {
+						if report_err := report_close(); report_err != nil {
+							return report_err
+						}
+						break
+					}
+				}
+				state.closeDepth = close_depth + 1
+				unread(token)
+				return nil
+			}
 
-			if has_script_type {
-				script_type = tag_script_type
+			if report_err := report_close(); report_err != nil {
+				return report_err
 			}
+			if read_tag.ElementName == ELEMENT_P { //a stray `</p>` gets an empty paragraph.
+				empty_paragraph := &Element{ElementName: ELEMENT_P, Attributes: map[string]string{}, position: read_tag.position}
+				if handler_err := handler.StartElement(empty_paragraph); handler_err != nil {
+					return handler_err
+				}
+				if handler_err := handler.EndElement(empty_paragraph); handler_err != nil {
+					return handler_err
+				}
+			}
+			continue
+		}
 
-			script_contents, script_error := readUntilScriptTagClose(body, cursor, script_type)
-			if script_error != nil {
-				return script_error
+		//a second html, head or body start tag is dropped, and so are the parts of a table outside of one (except in
+		//a fragment without a context, where there's no telling where it'll go).
+		if (read_tag.ElementName == ELEMENT_HTML || read_tag.ElementName == ELEMENT_BODY) && tagStack.Contains(read_tag.ElementName) {
+			continue
+		} else if TABLE_PART_ELEMENTS[read_tag.ElementName] && !isForeignNamespace(read_tag.Namespace) && !containsAny(tagStack, ELEMENT_TABLE, ELEMENT_TEMPLATE) && (!state.fragment || state.baseDepth > 0) {
+			continue
+		} else if read_tag.ElementName == ELEMENT_HEAD {
+			//a fragment can have more than one head, but the first still stops another being implied.
+			if state.sawHead && !state.fragment {
+				continue
 			}
+			state.sawHead = true
+		} else if read_tag.ElementName == ELEMENT_BODY || read_tag.ElementName == "frameset" {
+			state.sawBody = true
+		}
 
-			script_body := newTextNode(script_contents)
-			read_tag.AddChild(script_body)
-			parentElement.AddChild(read_tag)
-		} else {
-			new_stack := tagStack.Duplicate()
-			new_stack.Push(*read_tag)
-			parse_children_error := parseChildren(read_tag, body, cursor, new_stack, shouldCheckElementStack)
-			parentElement.AddChild(read_tag)
+		if handler_err := handler.StartElement(read_tag); handler_err != nil {
+			return handler_err
+		}
+		if !read_tag.IsVoid {
+			//the stack is shared by every level; each takes its element back off once it's done with it.
+			open_count := tagStack.Count
+			tagStack.Push(*read_tag)
+			parse_children_error := parseChildren(read_tag, tokenizer, tagStack, state, handler)
+			tagStack.Truncate(open_count)
 			if parse_children_error != nil {
 				return parse_children_error
 			}
 		}
+		if handler_err := handler.EndElement(read_tag); handler_err != nil {
+			return handler_err
+		}
+	}
+	if !is_ended {
+		end_element(tokenizer.scanner.Location(), tokenizer.scanner.Offset())
 	}
-	parentElement.InnerHTML = string(body[parse_start:*cursor])
 	return nil
 }
 
-func newTextNode(text []rune) *Element {
-	return &Element{ElementName: ELEMENT_INTERNAL_TEXT, IsText: true, IsVoid: true, InnerHTML: string(text)}
+// impliedAtEOF adds the head and body missing from the `html` element when the input runs out.
+func impliedAtEOF(html *Element, location Location, state *parseState, handler Handler) error {
+	implied := []string{ELEMENT_BODY}
+	if !state.sawHead {
+		implied = []string{ELEMENT_HEAD, ELEMENT_BODY}
+	}
+	state.sawHead, state.sawBody = true, true
+
+	for _, name := range implied {
+		element := &Element{ElementName: name, Namespace: html.Namespace, Attributes: map[string]string{}, position: Position{Start: location, End: location}}
+		if handler_err := handler.StartElement(element); handler_err != nil {
+			return handler_err
+		}
+		if handler_err := handler.EndElement(element); handler_err != nil {
+			return handler_err
+		}
+	}
+	return nil
+}
+
+// reportUnclosed reports the elements open at the end of the input, outermost first, except those whose end tags
+// are optional there.
+func reportUnclosed(tagStack *elementStack, state *parseState) error {
+	open_names := tagStack.Names()
+	open_elements := make([]Element, tagStack.Count)
+	x := tagStack.Count - 1
+	for nodePtr := tagStack.Top; nodePtr != nil; nodePtr = nodePtr.Next {
+		open_elements[x] = nodePtr.Value
+		x--
+	}
+	open_elements = open_elements[state.baseDepth:] //a fragment's context was open before it started.
+
+	for _, open_element := range open_elements {
+		switch open_element.ElementName {
+		case ELEMENT_HTML, ELEMENT_HEAD, ELEMENT_BODY:
+			continue
+		}
+		if OPTIONAL_END_TAG_ELEMENTS[open_element.ElementName] {
+			continue
+		}
+		parse_error := &ParseError{Code: PARSE_ERROR_UNCLOSED_ELEMENT, Location: open_element.position.Start, Expected: open_element.ElementName, Path: open_names}
+		if report_err := state.report(parse_error); report_err != nil {
+			return report_err
+		}
+	}
+	return nil
+}
+
+func newTextNode(text string) *Element {
+	return &Element{ElementName: ELEMENT_INTERNAL_TEXT, IsText: true, IsVoid: true, SourceHTML: text, Text: text}
+}
+
+func newCommentNode(text string) *Element {
+	return &Element{ElementName: ELEMENT_INTERNAL_XML_COMMENT, IsComment: true, IsVoid: true, SourceHTML: text, Text: text, Attributes: map[string]string{}}
+}
+
+func newElementFromToken(token Token) *Element {
+	position := Position{Start: token.Start, End: token.End}
+	if token.Type == TOKEN_TEXT {
+		text := newTextNode(token.Data)
+		text.SourceHTML = token.Raw
+		text.position = position
+		return text
+	} else if token.Type == TOKEN_COMMENT {
+		comment := newCommentNode(token.Data)
+		comment.position = position
+		return comment
+	} else if token.Type == TOKEN_CDATA {
+		return &Element{ElementName: ELEMENT_INTERNAL_CDATA, IsCData: true, IsVoid: true, SourceHTML: token.Data, Text: token.Data, Attributes: map[string]string{}, position: position}
+	} else if token.Type == TOKEN_PROCESSING_INSTRUCTION {
+		return &Element{ElementName: ELEMENT_INTERNAL_PROCESSING_INSTRUCTION, IsProcessingInstruction: true, IsVoid: true, SourceHTML: token.Data, Text: token.Data, Attributes: map[string]string{}, position: position}
+	} else if token.Type == TOKEN_DOCTYPE {
+		doctype := parseDoctype(token.Data)
+		return &Element{ElementName: ELEMENT_DOCTYPE, IsDoctype: true, IsVoid: true, Doctype: &doctype, Attributes: map[string]string{}, position: position}
+	}
+
+	elem := &Element{ElementName: token.Name, Attributes: map[string]string{}, position: position}
+	for _, attr := range token.Attributes {
+		if _, has_attr := elem.Attributes[attr.Name]; !has_attr {
+			elem.Attributes[attr.Name] = attr.Value
+		}
+		elem.attributeList = append(elem.attributeList, attr)
+	}
+
+	switch token.Type {
+	case TOKEN_END_TAG:
+		elem.IsClose = true
+	case TOKEN_SELF_CLOSING_TAG:
+		elem.IsVoid = true
+	}
+	elem.IsVoid = elem.IsVoid || isKnownVoidElement(elem.ElementName)
+	return elem
 }
 
 //--------------------------------------------------------------------------------
@@ -115,9 +488,13 @@ func newTextNode(text []rune) *Element {
 const (
 	EMPTY = ""
 
-	ELEMENT_INTERNAL_XML_COMMENT = "xmlcomment"
-	ELEMENT_INTERNAL_ROOT        = "root"
-	ELEMENT_INTERNAL_TEXT        = "text"
+	SCANNER_BUFFER_SIZE = 4096
+
+	ELEMENT_INTERNAL_XML_COMMENT            = "xmlcomment"
+	ELEMENT_INTERNAL_ROOT                   = "root"
+	ELEMENT_INTERNAL_TEXT                   = "text"
+	ELEMENT_INTERNAL_CDATA                  = "cdata"
+	ELEMENT_INTERNAL_PROCESSING_INSTRUCTION = "processinginstruction"
 
 	//note, the following sourced from https://developer.mozilla.org/en-US/docs/Web/HTML/Element
 	ELEMENT_DOCTYPE = "doctype"
@@ -135,6 +512,9 @@ const (
 
 	ELEMENT_ADDRESS = "address"
 	ELEMENT_ARTICLE = "article"
+	ELEMENT_ASIDE   = "aside"
+	ELEMENT_FOOTER  = "footer"
+	ELEMENT_HEADER  = "header"
 	ELEMENT_NAV     = "nav"
 	ELEMENT_SECTION = "section"
 
@@ -146,10 +526,13 @@ const (
 	ELEMENT_H6     = "h6"
 	ELEMENT_HGROUP = "hgroup"
 
+	ELEMENT_BLOCKQUOTE = "blockquote"
 	ELEMENT_DD         = "dd"
 	ELEMENT_DIV        = "div"
 	ELEMENT_DL         = "dl"
+	ELEMENT_DT         = "dt"
 	ELEMENT_FIGCAPTION = "figcaption"
+	ELEMENT_FIGURE     = "figure"
 	ELEMENT_HR         = "hr"
 	ELEMENT_LI         = "li"
 	ELEMENT_MAIN       = "main"
@@ -233,6 +616,7 @@ const (
 	ELEMENT_OUTPUT   = "output"
 	ELEMENT_PROGRESS = "progress"
 	ELEMENT_SELECT   = "select"
+	ELEMENT_TEXTAREA = "textarea"
 
 	ELEMENT_DETAILS  = "details"
 	ELEMENT_DIALOG   = "dialog"
@@ -283,35 +667,127 @@ var (
 		ELEMENT_COL, ELEMENT_COLGROUP, ELEMENT_TABLE, ELEMENT_THEAD, ELEMENT_TBODY, ELEMENT_TFOOT,
 		ELEMENT_TH, ELEMENT_TR, ELEMENT_TD, ELEMENT_BUTTON, ELEMENT_DATALIST, ELEMENT_FIELDSET,
 		ELEMENT_FORM, ELEMENT_INPUT, ELEMENT_KEYGEN, ELEMENT_LABEL, ELEMENT_LEGEND, ELEMENT_METER,
-		ELEMENT_OPTGROUP, ELEMENT_OPTION, ELEMENT_OUTPUT, ELEMENT_PROGRESS, ELEMENT_SELECT,
+		ELEMENT_OPTGROUP, ELEMENT_OPTION, ELEMENT_OUTPUT, ELEMENT_PROGRESS, ELEMENT_SELECT, ELEMENT_TEXTAREA,
 		ELEMENT_DETAILS, ELEMENT_DIALOG, ELEMENT_MENU, ELEMENT_MENUITEM, ELEMENT_SUMMARY,
 		ELEMENT_CONTENT, ELEMENT_DECORATOR, ELEMENT_SHADOW, ELEMENT_TEMPLATE, ELEMENT_A,
+		ELEMENT_ASIDE, ELEMENT_FOOTER, ELEMENT_HEADER, ELEMENT_BLOCKQUOTE, ELEMENT_DT, ELEMENT_FIGURE,
 	}
 )
 
+//--------------------------------------------------------------------------------
+// TYPES: POSITION
+//--------------------------------------------------------------------------------
+
+// Location is a point in the parsed source: a byte offset plus a 1-based line and column (in runes).
+type Location struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Advance returns the location after reading `text` from `l`.
+func (l Location) Advance(text string) Location {
+	for _, c := range text {
+		l.Offset = l.Offset + utf8.RuneLen(c)
+		if c == '\n' {
+			l.Line++
+			l.Column = 1
+		} else {
+			l.Column++
+		}
+	}
+	return l
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%d:%d", l.Line, l.Column)
+}
+
+// Position is the span of source an element, token or attribute was parsed from.
+type Position struct {
+	Start Location
+	End   Location
+}
+
 //--------------------------------------------------------------------------------
 // TYPES: ELEMENT
 //--------------------------------------------------------------------------------
 
 type ElementPredicate func(*Element) bool
 
+// Element is a node in a document tree. Nodes are linked by pointer, so a change made through any
+// reference to a node is seen from everywhere else in the tree. The links are the tree itself; change
+// them with AddChild and the other tree methods so they stay consistent.
 type Element struct {
 	ElementName string
 	Parent      *Element
-	InnerHTML   string
+	// SourceHTML is the html the element was parsed from: an element's inner html, or the raw text of a text node.
+	// It isn't kept up to date as the tree changes; InnerHTML and OuterHTML are. Elements only have it when
+	// parsed from a string, where it shares the string's memory; the reader parsers leave it empty.
+	SourceHTML  string
 	Attributes  map[string]string
-	Children    []Element
+	FirstChild  *Element
+	LastChild   *Element
+	PrevSibling *Element
+	NextSibling *Element
 	IsText      bool
 	IsVoid      bool
 	IsComment   bool
 	IsRoot      bool
 	IsClose     bool
 	IsData      bool
+	// Namespace is the html, svg or mathml namespace uri of a parsed element.
+	Namespace string
+
+	IsDoctype               bool
+	IsCData                 bool
+	IsProcessingInstruction bool
+
+	// Text is the decoded contents of a text node, or the data of a comment, cdata section or processing instruction.
+	Text string
+	// Doctype is set on doctype nodes.
+	Doctype *Doctype
+
+	position      Position
+	attributeList []Attribute
+	quirksMode    QuirksMode
 }
 
+// AddChild adds `newChild` as the last child of the element, moving it if it's already in a tree.
 func (e *Element) AddChild(newChild *Element) {
-	newChild.Parent = e
-	e.Children = append(e.Children, *newChild)
+	insertChild(e, newChild, nil)
+}
+
+// Children returns the element's children in order, read from its `FirstChild` / `NextSibling` links.
+func (e Element) Children() []*Element {
+	children := []*Element{}
+	for child := e.FirstChild; child != nil; child = child.NextSibling {
+		children = append(children, child)
+	}
+	return children
+}
+
+// QuirksMode returns the rendering mode a parsed document is in, decided by its doctype; it's only set on the root.
+func (e Element) QuirksMode() QuirksMode {
+	return e.quirksMode
+}
+
+// Position returns where the element was found in the parsed source, from the start of its opening
+// tag to the end of its closing tag. Elements that weren't parsed have a zero position.
+func (e Element) Position() Position {
+	return e.position
+}
+
+// AttributePosition returns where the named attribute was found in the element's opening tag.
+func (e Element) AttributePosition(name string) (Position, bool) {
+	attr, has_attr := e.findAttribute(name)
+	return attr.Position, has_attr
+}
+
+// RawAttribute returns the named attribute's value as it was in the source, before character references were decoded.
+func (e Element) RawAttribute(name string) (string, bool) {
+	attr, has_attr := e.findAttribute(name)
+	return attr.Raw, has_attr
 }
 
 func (e *Element) AddClass(className string) {
@@ -319,14 +795,14 @@ func (e *Element) AddClass(className string) {
 
 	elem_class, elem_has_class_attr := e.Attributes["class"]
 	if elem_has_class_attr {
-		e.Attributes["class"] = fmt.Sprintf("%s %s", elem_class, class_name_lower)
+		e.SetAttr("class", fmt.Sprintf("%s %s", elem_class, class_name_lower))
 	} else {
-		e.Attributes["class"] = class_name_lower
+		e.SetAttr("class", class_name_lower)
 	}
 }
 
 func (e *Element) SetId(id string) {
-	e.Attributes["id"] = id
+	e.SetAttr("id", id)
 }
 
 func (e Element) GetId() string {
@@ -339,22 +815,37 @@ func (e Element) GetId() string {
 }
 
 func (e Element) GetInnerText() string {
-	text := EMPTY
-	for _, child := range e.Flatten() {
-		if child.IsText {
-			text = text + child.InnerHTML
-		}
+	text := &strings.Builder{}
+	e.TextTo(text)
+	return text.String()
+}
+
+// TextTo writes the text GetInnerText returns to `w`, through a buffer.
+func (e Element) TextTo(w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	hw := &htmlWriter{w: buffered}
+	writeText(hw, &e)
+	if hw.err != nil {
+		return hw.err
 	}
+	return buffered.Flush()
+}
 
-	return text
+func writeText(hw *htmlWriter, e *Element) {
+	for child := e.FirstChild; child != nil && hw.err == nil; child = child.NextSibling {
+		if child.IsText || child.IsCData {
+			hw.WriteString(child.Text)
+		}
+		writeText(hw, child)
+	}
 }
 
-func (e Element) GetPath() []Element {
-	elements := []Element{}
+func (e Element) GetPath() []*Element {
+	elements := []*Element{}
 
 	node_ptr := e.Parent
 	for node_ptr != nil && !node_ptr.IsRoot {
-		elements = append(elements, *node_ptr)
+		elements = append(elements, node_ptr)
 		node_ptr = node_ptr.Parent
 	}
 
@@ -371,21 +862,19 @@ func (e Element) HasClass(className string) bool {
 	return false
 }
 
-func (e Element) Flatten() []Element {
-	results := []Element{}
-	for _, child := range e.Children {
+func (e Element) Flatten() []*Element {
+	results := []*Element{}
+	for child := e.FirstChild; child != nil; child = child.NextSibling {
 		results = append(results, child)
-		for _, sub_child := range child.Flatten() {
-			results = append(results, sub_child)
-		}
+		results = append(results, child.Flatten()...)
 	}
 
 	return results
 }
 
-func (e Element) GetElementsByTagName(tagName string) []Element {
+func (e Element) GetElementsByTagName(tagName string) []*Element {
 	tag_name_lower := strings.ToLower(tagName)
-	results := []Element{}
+	results := []*Element{}
 	for _, child := range e.Flatten() {
 		if tag_name_lower == strings.ToLower(child.ElementName) {
 			results = append(results, child)
@@ -394,19 +883,19 @@ func (e Element) GetElementsByTagName(tagName string) []Element {
 	return results
 }
 
-func (e Element) GetElementsByPredicate(predicate ElementPredicate) []Element {
-	results := []Element{}
+func (e Element) GetElementsByPredicate(predicate ElementPredicate) []*Element {
+	results := []*Element{}
 	for _, child := range e.Flatten() {
-		if predicate(&child) {
+		if predicate(child) {
 			results = append(results, child)
 		}
 	}
 	return results
 }
 
-func (e Element) GetElementsByClassName(className string) []Element {
+func (e Element) GetElementsByClassName(className string) []*Element {
 	class_name_lower := strings.ToLower(className)
-	results := []Element{}
+	results := []*Element{}
 	for _, child := range e.Flatten() {
 		if child.HasClass(class_name_lower) {
 			results = append(results, child)
@@ -418,27 +907,79 @@ func (e Element) GetElementsByClassName(className string) []Element {
 func (e Element) GetElementById(id string) *Element {
 	for _, child := range e.Flatten() {
 		if child.Attributes["id"] == id {
-			return &child
+			return child
 		}
 	}
 	return nil
 }
 
-/* eventually ...
-func (e Element) QueryXpath(xpathQuery string) ([]Element, error) {
-	return []Element{}, nil
+// QueryXpath evaluates an xpath 1.0 expression with the element as the context node. Attribute
+// nodes in the result are returned as text nodes holding the attribute value.
+func (e Element) QueryXpath(xpathQuery string) ([]*Element, error) {
+	expr, expr_err := parseXpath(xpathQuery)
+	if expr_err != nil {
+		return nil, expr_err
+	}
+
+	value, value_err := expr.Evaluate(xpathContext{Node: newXpathDocument(&e), Position: 1, Size: 1})
+	if value_err != nil {
+		return nil, value_err
+	}
+	nodes, is_nodes := value.([]*xpathNode)
+	if !is_nodes {
+		return nil, fmt.Errorf("xpath: `%s` does not evaluate to a node-set", xpathQuery)
+	}
+
+	results := []*Element{}
+	for _, node := range nodes {
+		results = append(results, node.ToElement())
+	}
+	return results, nil
 }
 
-func (e Element) QuerySelector(cssSelectorQuery string) ([]Element, error) {
-	return []Element{}, nil
+// QueryXpathString evaluates an xpath 1.0 expression and converts the result with the xpath `string()` rules.
+func (e Element) QueryXpathString(xpathQuery string) (string, error) {
+	expr, expr_err := parseXpath(xpathQuery)
+	if expr_err != nil {
+		return EMPTY, expr_err
+	}
+
+	value, value_err := expr.Evaluate(xpathContext{Node: newXpathDocument(&e), Position: 1, Size: 1})
+	if value_err != nil {
+		return EMPTY, value_err
+	}
+	return xpathString(value), nil
+}
+
+// QuerySelectorAll returns every descendant of the element matching the css selector group, in document order.
+func (e Element) QuerySelectorAll(cssSelectorQuery string) ([]*Element, error) {
+	selector, selector_err := CompileSelector(cssSelectorQuery)
+	if selector_err != nil {
+		return nil, selector_err
+	}
+	return selector.Select(&e), nil
+}
+
+// QuerySelector returns the first descendant of the element matching the css selector group, or nil.
+func (e Element) QuerySelector(cssSelectorQuery string) (*Element, error) {
+	selector, selector_err := CompileSelector(cssSelectorQuery)
+	if selector_err != nil {
+		return nil, selector_err
+	}
+
+	for _, child := range e.Flatten() {
+		if selector.Match(child) {
+			return child, nil
+		}
+	}
+	return nil, nil
 }
-*/
 
 func (e Element) GetText() string {
 	textElements := e.GetElementsByTagName(ELEMENT_INTERNAL_TEXT)
 	textElementBodies := []string{}
 	for _, textElement := range textElements {
-		textElementBodies = append(textElementBodies, textElement.InnerHTML)
+		textElementBodies = append(textElementBodies, textElement.Text)
 	}
 	return strings.Join(textElementBodies, EMPTY)
 }
@@ -453,10 +994,7 @@ func (e Element) EqualTo(e2 Element) bool {
 	if e.IsClose != e2.IsClose {
 		return false
 	}
-	if e.InnerHTML != e2.InnerHTML {
-		return false
-	}
-	if len(e.Children) != len(e2.Children) {
+	if e.Text != e2.Text {
 		return false
 	}
 	if len(e.Attributes) != len(e2.Attributes) {
@@ -465,15 +1003,20 @@ func (e Element) EqualTo(e2 Element) bool {
 	if !reflect.DeepEqual(e.Attributes, e2.Attributes) {
 		return false
 	}
-	for index := 0; index < len(e.Children); index++ {
-		childA := e.Children[index]
-		childB := e2.Children[index]
-		if !childA.EqualTo(childB) {
+	if !reflect.DeepEqual(e.Doctype, e2.Doctype) {
+		return false
+	}
+	if e.Namespace != e2.Namespace {
+		return false
+	}
+	childA, childB := e.FirstChild, e2.FirstChild
+	for ; childA != nil && childB != nil; childA, childB = childA.NextSibling, childB.NextSibling {
+		if !childA.EqualTo(*childB) {
 			return false
 		}
 	}
 
-	return true
+	return childA == nil && childB == nil
 }
 
 func (e Element) ToString() string {
@@ -481,36 +1024,41 @@ func (e Element) ToString() string {
 		return EMPTY
 	}
 
-	if e.IsText && isContinuousWhitespace([]rune(e.InnerHTML)) {
+	if e.IsText && isContinuousWhitespace([]rune(e.SourceHTML)) {
 		return EMPTY
 	} else if e.IsText {
-		return trimString(e.InnerHTML)
+		return trimString(e.SourceHTML)
 	}
 
 	if e.IsComment {
-		return fmt.Sprintf("<!--%s-->", trimString(e.InnerHTML))
+		return fmt.Sprintf("<!--%s-->", trimString(e.Text))
+	} else if e.IsDoctype && e.Doctype != nil {
+		return e.Doctype.String()
+	} else if e.IsCData {
+		return fmt.Sprintf("<![CDATA[%s]]>", e.Text)
+	} else if e.IsProcessingInstruction {
+		return fmt.Sprintf("<?%s?>", e.Text)
 	}
 
+	attributes := serializedAttributes(&e)
 	if e.IsVoid {
-		if len(e.Attributes) == 0 {
+		if len(attributes) == 0 {
 			return fmt.Sprintf("<%s/>", e.ElementName)
 		} else {
-			return fmt.Sprintf("<%s %s/>", e.ElementName, stringifyMap(e.Attributes))
+			return fmt.Sprintf("<%s %s/>", e.ElementName, stringifyAttributes(attributes))
 		}
 	} else {
-		if len(e.Attributes) == 0 {
+		if len(attributes) == 0 {
 			return fmt.Sprintf("<%s>", e.ElementName)
 		} else {
-			return fmt.Sprintf("<%s %s>", e.ElementName, stringifyMap(e.Attributes))
+			return fmt.Sprintf("<%s %s>", e.ElementName, stringifyAttributes(attributes))
 		}
 	}
-
-	return EMPTY
 }
 
-func (e Element) NonTextChildren() []Element {
-	elems := []Element{}
-	for _, c := range e.Children {
+func (e Element) NonTextChildren() []*Element {
+	elems := []*Element{}
+	for c := e.FirstChild; c != nil; c = c.NextSibling {
 		if !c.IsText {
 			elems = append(elems, c)
 		}
@@ -518,32 +1066,16 @@ func (e Element) NonTextChildren() []Element {
 	return elems
 }
 
+// Render returns the element as indented html, one node to a line; see RenderWithOptions for more control.
 func (e Element) Render() string {
-	if e.IsRoot {
-		str := EMPTY
-		for _, child := range e.Children {
-			str = str + child.renderImpl(0)
-		}
-		return str
-	} else {
-		return e.renderImpl(0)
-	}
+	out := &strings.Builder{}
+	e.RenderTo(out)
+	return out.String()
 }
 
-func (e Element) renderImpl(nesting int) string {
-	str := tabSequence(nesting) + e.ToString()
-
-	str = str + "\n"
-
-	for _, child := range e.Children {
-		str = str + child.renderImpl(nesting+1)
-	}
-
-	if !(e.IsVoid || e.IsText || e.IsComment || e.IsRoot) {
-		str = str + tabSequence(nesting) + fmt.Sprintf("</%s>\n", e.ElementName)
-	}
-
-	return str
+// RenderTo writes the element to `w` the way Render does, through a buffer.
+func (e Element) RenderTo(w io.Writer) error {
+	return e.RenderWithOptionsTo(w, DEFAULT_RENDER_OPTIONS)
 }
 
 //--------------------------------------------------------------------------------
@@ -555,13 +1087,22 @@ type elementStackNode struct {
 	Value Element
 }
 
+// elementStack keeps the names of the elements on it as a slice too, and how many of each are open, so
+// neither reading them nor checking for one walks the stack.
 type elementStack struct {
-	Top   *elementStackNode
-	Count int
+	Top    *elementStackNode
+	Count  int
+	names  []string
+	counts map[string]int
 }
 
 func (es *elementStack) Push(e Element) {
 	es.Count = es.Count + 1
+	es.names = append(es.names, e.ElementName)
+	if es.counts == nil {
+		es.counts = map[string]int{}
+	}
+	es.counts[e.ElementName]++
 	if es.Top == nil {
 		es.Top = &elementStackNode{Next: nil, Value: e}
 	} else {
@@ -576,6 +1117,8 @@ func (es *elementStack) Pop() *Element {
 	}
 
 	es.Count = es.Count - 1
+	es.names = es.names[:es.Count]
+	es.counts[es.Top.Value.ElementName]--
 
 	toReturn := es.Top.Value
 	newNext := es.Top.Next
@@ -594,15 +1137,24 @@ func (es *elementStack) ToString() string {
 	if es.Top == nil {
 		return "*"
 	}
+	return strings.Join(es.Names(), " > ")
+}
 
-	names := []string{}
-	nodePtr := es.Top
-	for nodePtr != nil {
-		names = append([]string{nodePtr.Value.ElementName}, names...)
-		nodePtr = nodePtr.Next
+// Contains reports whether an element with the given name is on the stack.
+func (es *elementStack) Contains(elementName string) bool {
+	return es.counts[elementName] > 0
+}
+
+// Truncate pops elements until there are only `count` left.
+func (es *elementStack) Truncate(count int) {
+	for es.Count > count {
+		es.Pop()
 	}
+}
 
-	return strings.Join(names, " > ")
+// Names returns a copy of the element names on the stack, outermost first.
+func (es *elementStack) Names() []string {
+	return append([]string{}, es.names...)
 }
 
 func (es elementStack) Duplicate() *elementStack {
@@ -627,6 +1179,115 @@ func (es elementStack) Duplicate() *elementStack {
 	return new_es
 }
 
+//--------------------------------------------------------------------------------
+// TYPES: RUNE SCANNER
+//--------------------------------------------------------------------------------
+
+// runeScanner reads runes from a buffered reader. It keeps the text read since the last `Discard()` so that
+// tokens can capture their source html.
+// Read errors are kept and surfaced by `Err()`.
+type runeScanner struct {
+	reader     *bufio.Reader
+	source     []byte
+	offset     int
+	lastSize   int
+	lines      int
+	column     int
+	lastColumn int
+	err        error
+}
+
+func newRuneScanner(r io.Reader) *runeScanner {
+	return &runeScanner{reader: bufio.NewReader(r)}
+}
+
+// Next returns the next rune, or false at the end of the input.
+func (rs *runeScanner) Next() (rune, bool) {
+	c, size, read_err := rs.reader.ReadRune()
+	if read_err != nil {
+		if read_err != io.EOF {
+			rs.err = read_err
+		}
+		return 0, false
+	}
+
+	rs.source = utf8.AppendRune(rs.source, c)
+	rs.offset = rs.offset + size
+	rs.lastSize = size
+	rs.lastColumn = rs.column
+	if c == '\n' {
+		rs.lines++
+		rs.column = 0
+	} else {
+		rs.column++
+	}
+	return c, true
+}
+
+// Unread steps back over the rune just returned by `Next()`.
+func (rs *runeScanner) Unread() {
+	c, size := utf8.DecodeLastRune(rs.source)
+	rs.source = rs.source[:len(rs.source)-size]
+	rs.offset = rs.offset - rs.lastSize
+	rs.column = rs.lastColumn
+	if c == '\n' {
+		rs.lines--
+	}
+	rs.reader.UnreadRune()
+}
+
+// StartsTag returns if the input from here is a `<` that begins markup, without reading any of it.
+func (rs *runeScanner) StartsTag() bool {
+	next, _ := rs.reader.Peek(2)
+	return len(next) == 2 && next[0] == '<' && isTagOpen(next[1])
+}
+
+func (rs *runeScanner) AtEOF() bool {
+	_, peek_err := rs.reader.Peek(1)
+	if peek_err != nil && peek_err != io.EOF {
+		rs.err = peek_err
+	}
+	return peek_err != nil
+}
+
+// Discard drops the text kept so far. A buffer grown past SCANNER_BUFFER_SIZE by a long token is let go
+// rather than reused, so one big text node doesn't pin its memory for the rest of the parse.
+func (rs *runeScanner) Discard() {
+	if cap(rs.source) > SCANNER_BUFFER_SIZE {
+		rs.source = nil
+	} else {
+		rs.source = rs.source[:0]
+	}
+}
+
+// Offset is the byte offset of the next rune in the input.
+func (rs *runeScanner) Offset() int {
+	return rs.offset
+}
+
+// Location is where the next rune sits in the input.
+func (rs *runeScanner) Location() Location {
+	return Location{Offset: rs.offset, Line: rs.lines + 1, Column: rs.column + 1}
+}
+
+// Mark returns a position in the kept text that can be passed to `Source()`.
+func (rs *runeScanner) Mark() int {
+	return len(rs.source)
+}
+
+// Source returns the html read since `mark`.
+func (rs *runeScanner) Source(mark int) string {
+	return string(rs.source[mark:])
+}
+
+func (rs *runeScanner) Lines() int {
+	return rs.lines
+}
+
+func (rs *runeScanner) Err() error {
+	return rs.err
+}
+
 //--------------------------------------------------------------------------------
 // UTILITY
 //--------------------------------------------------------------------------------
@@ -642,265 +1303,215 @@ func readWhitespace(text []rune, cursor *int) ([]rune, error) {
 	return text[startingPosition:*cursor], nil
 }
 
-func readUntilTag(text []rune, cursor *int) ([]rune, error) {
-	startingPosition := *cursor
-	for ; *cursor < len(text); *cursor++ {
-		c := text[*cursor]
-		if !isWhitespace(c) {
-			if c == '<' {
-				return text[startingPosition:*cursor], nil
+func readUntilTag(scanner *runeScanner) ([]rune, error) {
+	results := []rune{}
+	for {
+		c, ok := scanner.Next()
+		if !ok {
+			break
+		}
+		if c == '<' {
+			scanner.Unread()
+			if scanner.StartsTag() {
+				break
 			}
+			c, _ = scanner.Next()
 		}
+		results = append(results, c)
 	}
-	return text[startingPosition:*cursor], nil
+	return results, scanner.Err()
 }
 
-func readUntilScriptTagClose(text []rune, cursor *int, scriptType string) ([]rune, error) {
-	starting_position := *cursor
-	tag_start := 0
-	working_tag := EMPTY
-
-	const quote_double = rune('"')
-	const quote_single = rune('\'')
-
-	var quote_character rune
+// isTagOpen returns if `c` after a `<` starts markup; anything else, like the space in `a < b`, leaves the `<` as text.
+func isTagOpen(c byte) bool {
+	return isAsciiLetter(c) || c == '/' || c == '!' || c == '?'
+}
 
-	state := 0
-	for ; *cursor < len(text); *cursor++ {
-		c := text[*cursor]
+// readUntilEndTag reads raw text up to the end tag for `elementName`, which is consumed but not returned.
+// `<plaintext>` has no end tag, so its contents run to the end of the input.
+func readUntilEndTag(scanner *runeScanner, elementName string) ([]rune, bool, error) {
+	contents := []rune{}
+	for {
+		c, ok := scanner.Next()
+		if !ok {
+			return contents, false, scanner.Err()
+		}
+		if c != '<' || elementName == "plaintext" {
+			contents = append(contents, c)
+			continue
+		}
 
-		switch state {
-		case 0:
-			if c == '/' && scriptType == "text/javascript" { //only kick off javascript style quote escapes if we're in js
-				state = 21
-			} else if c == '<' {
-				tag_start = *cursor
-				state = 11
-			} else if c == quote_double || c == quote_single {
-				state = 30
-				quote_character = c
+		candidate := []rune{c}
+		is_match := true
+		for _, expected := range "/" + elementName {
+			c, ok = scanner.Next()
+			if !ok {
+				return append(contents, candidate...), false, scanner.Err()
 			}
-			break
-		case 11: //we're within a html tag in the code ...
-			if c == '/' {
-				state = 12
+			if unicode.ToLower(c) != expected {
+				is_match = false
+				break
+			}
+			candidate = append(candidate, c)
+		}
+
+		if is_match {
+			c, ok = scanner.Next()
+			if !ok {
+				return append(contents, candidate...), false, scanner.Err()
 			}
-			break
-		case 12:
 			if c == '>' {
-				if strings.ToLower(working_tag) == "script" {
-					*cursor = *cursor + 1
-					return text[starting_position:tag_start], nil
+				return contents, true, nil
+			} else if isWhitespace(c) || c == '/' {
+				for c != '>' && ok {
+					c, ok = scanner.Next()
 				}
-			} else if !isWhitespace(c) {
-				working_tag = working_tag + string(c)
-			}
-			break
-		case 21: //we hit a slash, which might be a comment
-			if c == '*' {
-				state = 25
-			} else if c == '/' {
-				state = 22
-			} else {
-				state = 0
-			}
-			break
-		case 22: //read comment until newline or end of tag
-			if c == '\n' {
-				state = 0
-			}
-			break
-		case 25: //almost a block comment close
-			if c == '*' {
-				state = 26
-			}
-		case 26: //definitely a block comment close
-			if c == '/' {
-				state = 0
-			}
-		case 30:
-			if c == quote_character {
-				state = 0
+				return contents, true, scanner.Err()
 			}
 		}
+		//not the end tag after all; the rune that didn't match could start one, so read it again.
+		scanner.Unread()
+		contents = append(contents, candidate...)
 	}
-
-	return text[starting_position:*cursor], nil
 }
 
-func readTag(text []rune, cursor *int) (*Element, error) {
-	elem := Element{}
-	elem.Attributes = map[string]string{}
-
-	state := 0
-
-	parser_error := EMPTY
-
-	attr_name := EMPTY
-	attr_value := EMPTY
-	element_name := EMPTY
-	const quote_double = rune('"')
-	const quote_single = rune('\'')
-
-	var quote_character rune
+// readUntilScriptEnd reads the contents of a script element up to its end tag, following the html tokenizer's
+// script data states: the script ends at the first `</script`, except within a `<!--` that opens another `<script`.
+// The language of the script doesn't matter. The end tag is consumed but not returned.
+func readUntilScriptEnd(scanner *runeScanner) ([]rune, bool, error) {
+	const (
+		state_data = iota
+		state_escaped
+		state_escaped_dash
+		state_escaped_dash_dash
+		state_double_escaped
+		state_double_escaped_dash
+		state_double_escaped_dash_dash
+	)
+
+	contents := []rune{}
+	state := state_data
+
+	//readName reads letters after a `<` or `</` until a delimiter, which is left unread.
+	readName := func() string {
+		name := []rune{}
+		for {
+			c, ok := scanner.Next()
+			if !ok {
+				break
+			}
+			if !unicode.IsLetter(c) || c > unicode.MaxASCII {
+				scanner.Unread()
+				break
+			}
+			name = append(name, c)
+		}
+		contents = append(contents, name...)
+		return strings.ToLower(string(name))
+	}
+	isDelimiter := func() bool {
+		c, ok := scanner.Next()
+		if ok {
+			scanner.Unread()
+		}
+		return ok && (isWhitespace(c) || c == '/' || c == '>')
+	}
 
-	for ; *cursor < len(text); *cursor++ {
-		c := text[*cursor]
+	for {
+		c, ok := scanner.Next()
+		if !ok {
+			return contents, false, scanner.Err()
+		}
 
-		switch state {
-		case 0: //read until tag begins
-			if c == '<' {
-				state = 1
+		if c == '<' && state != state_double_escaped && state != state_double_escaped_dash && state != state_double_escaped_dash_dash {
+			is_escaped := state != state_data
+			c, ok = scanner.Next()
+			if !ok {
+				return append(contents, '<'), false, scanner.Err()
 			}
-			break
-		case 1: //read preamble if any
-			if c == '!' {
-				elem.IsVoid = true
-				state = 3
-				continue
-			} else if c == '/' {
-				elem.IsClose = true
-			} else if c == '>' {
-				parser_error = "Empty tag similar to `<>` or `< >` or `</>`"
-				state = 1001
-			} else if !isWhitespace(c) {
-				state = 10
-				element_name = element_name + string(c)
-			} //else is whitespace, keep going
-			break
-		case 2: //read until end of tag
+
 			if c == '/' {
-				elem.IsVoid = true
-				state = 500
-			} else if c == '>' {
-				state = 1000
-			} else if !isWhitespace(c) {
-				state = 100
-				element_name = element_name + string(c)
-			}
-			break
-		case 3: //possible xml comment
-			if c == '-' {
-				state = 4
-			} else {
-				*cursor = *cursor - 1
-				state = 1
-			}
-			break
-		case 4:
-			if c == '-' {
-				element_name = ELEMENT_INTERNAL_XML_COMMENT
-				elem.IsComment = true
-				state = 200 //consume xml comment
+				name_start := len(contents)
+				contents = append(contents, '<', '/')
+				if readName() == ELEMENT_SCRIPT && isDelimiter() {
+					for c != '>' && ok {
+						c, ok = scanner.Next()
+					}
+					return contents[:name_start], true, scanner.Err()
+				} else if is_escaped {
+					state = state_escaped
+				}
+			} else if c == '!' && !is_escaped {
+				contents = append(contents, '<', '!')
+				if c, ok = scanner.Next(); ok && c == '-' {
+					contents = append(contents, c)
+					if c, ok = scanner.Next(); ok && c == '-' {
+						contents = append(contents, c)
+						state = state_escaped_dash_dash
+					} else if ok {
+						scanner.Unread()
+					}
+				} else if ok {
+					scanner.Unread()
+				}
+			} else if is_escaped && c <= unicode.MaxASCII && unicode.IsLetter(c) {
+				scanner.Unread()
+				contents = append(contents, '<')
+				if readName() == ELEMENT_SCRIPT && isDelimiter() {
+					state = state_double_escaped
+				} else {
+					state = state_escaped
+				}
 			} else {
-				parser_error = "Malformed XML comment"
-				state = 1001
+				scanner.Unread()
+				contents = append(contents, '<')
+				if is_escaped {
+					state = state_escaped
+				}
 			}
-			break
-		case 10: //read elemName
-			if isWhitespace(c) {
-				state = 20
+			continue
+		}
+
+		contents = append(contents, c)
+		switch state {
+		case state_escaped, state_escaped_dash, state_escaped_dash_dash:
+			if c == '-' && state == state_escaped {
+				state = state_escaped_dash
 			} else if c == '-' {
-				state = 11
-			} else if c == '>' {
-				state = 1000
-			} else if c == '/' {
-				state = 500
-			} else {
-				element_name = element_name + string(c)
-			}
-			break
-		case 20: //read until attribute or end of tags
-			if c == '/' {
-				elem.IsVoid = true
-				state = 500
-			} else if c == '>' {
-				state = 1000
-			} else if !isWhitespace(c) {
-				*cursor = *cursor - 1
-				state = 100
-			}
-			break
-		case 100: //read attribute name
-			if c == '=' { //we are assigning an attribute value ...
-				state = 101
-			} else if c == '/' {
-				elem.Attributes[strings.ToLower(attr_name)] = EMPTY
-				state = 500
-			} else if c == '>' {
-				elem.Attributes[strings.ToLower(attr_name)] = EMPTY
-				state = 1000
-			} else if isWhitespace(c) {
-				elem.Attributes[strings.ToLower(attr_name)] = EMPTY
-				attr_name = ""
-				attr_value = ""
-				state = 20
-			} else {
-				attr_name = attr_name + string(c)
-			}
-			break
-		case 101: //set attribute value quote
-			if c == quote_single || c == quote_double {
-				quote_character = c
-				state = 102
-			} else if !isWhitespace(c) {
-				attr_value = attr_value + string(c)
-				state = 103
-			}
-		case 102: //read attribute value
-			if c == quote_character {
-				elem.Attributes[strings.ToLower(attr_name)] = attr_value
-				attr_name = ""
-				attr_value = ""
-				state = 20
+				state = state_escaped_dash_dash
+			} else if c == '>' && state == state_escaped_dash_dash {
+				state = state_data
 			} else {
-				attr_value = attr_value + string(c)
+				state = state_escaped
 			}
-			break
-		case 103: //read attribute value
-			if isWhitespace(c) {
-				elem.Attributes[strings.ToLower(attr_name)] = attr_value
-				attr_name = ""
-				attr_value = ""
-				state = 20
-			} else {
-				attr_value = attr_value + string(c)
-			}
-			break
-		case 200:
-			elem.ElementName = ELEMENT_INTERNAL_XML_COMMENT
-			elem.IsComment = true
-			if c == '-' {
-				state = 201
-			} else {
-				elem.InnerHTML = elem.InnerHTML + string(c)
-			}
-			break
-		case 201:
-			if c == '-' {
-				state = 500
+		case state_double_escaped, state_double_escaped_dash, state_double_escaped_dash_dash:
+			if c == '-' && state == state_double_escaped {
+				state = state_double_escaped_dash
+			} else if c == '-' {
+				state = state_double_escaped_dash_dash
+			} else if c == '>' && state == state_double_escaped_dash_dash {
+				state = state_data
+			} else if c == '<' {
+				//`</script` leaves the double escape, but doesn't end the script.
+				state = state_double_escaped
+				if next, next_ok := scanner.Next(); next_ok && next == '/' {
+					contents = append(contents, next)
+					if readName() == ELEMENT_SCRIPT && isDelimiter() {
+						state = state_escaped
+					}
+				} else if next_ok {
+					scanner.Unread()
+				}
 			} else {
-				state = 200
-				elem.InnerHTML = elem.InnerHTML + string(c)
+				state = state_double_escaped
 			}
-			break
-		case 500:
-			if c == '>' {
-				state = 1000
-			}
-			break
-		case 1000:
-			elem.ElementName = strings.ToLower(element_name)
-			elem.IsVoid = elem.IsVoid || isKnownVoidElement(elem.ElementName)
-			return &elem, nil
-		case 1001:
-			return &elem, errors.New(parser_error)
 		}
 	}
+}
 
-	elem.ElementName = strings.ToLower(element_name)
-	elem.IsVoid = elem.IsVoid || isKnownVoidElement(elem.ElementName)
-	return &elem, nil
+func readTag(scanner *runeScanner) (*Element, error) {
+	token, token_err := readTagToken(scanner, scanner.Mark())
+	return newElementFromToken(token), token_err
 }
 
 func sliceContains(slice []string, value string) bool {
@@ -912,31 +1523,11 @@ func sliceContains(slice []string, value string) bool {
 	return false
 }
 
-func tabSequence(ofLength int) string {
-	tabs := EMPTY
-	for i := 0; i < ofLength; i++ {
-		tabs = tabs + "  "
-	}
-	return tabs
-}
-
 func isKnownVoidElement(elementName string) bool {
 	_, ok := KNOWN_VOID_ELEMENTS[strings.ToLower(elementName)]
 	return ok
 }
 
-func stringifyMap(attributes map[string]string) string {
-	pairs := []string{}
-	for key, value := range attributes {
-		if len(value) == 0 {
-			pairs = append(pairs, key)
-		} else {
-			pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", key, value))
-		}
-	}
-	return strings.Join(pairs, " ")
-}
-
 func isContinuousWhitespace(corpus []rune) bool {
 	for i := 0; i < len(corpus); i++ {
 		c := corpus[i]
@@ -951,18 +1542,6 @@ func trimString(text string) string {
 	return string(trim([]rune(text)))
 }
 
-func countNewlinesBefore(body string, cursorPosition int) int {
-	count := 0
-	for x := 0; x < cursorPosition; x++ {
-		c := body[x]
-		if c == '\n' {
-			count++
-		}
-	}
-
-	return count
-}
-
 func trim(text []rune) []rune {
 	if len(text) == 0 {
 		return text
@@ -975,6 +1554,9 @@ func trim(text []rune) []rune {
 			break
 		}
 	}
+	if left == len(text) {
+		return text[:0]
+	}
 	right := len(text) - 1
 	for ; right > 0; right-- {
 		c := text[right]
@@ -1,7 +1,11 @@
 package html
 
 import (
+	"errors"
+	"io"
 	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -35,24 +39,24 @@ const SNIPPET = `<div id="first"><br><p><h1>Test!</h1></p></div><div id="second"
 const SNIPPET_INVALID = `<div id="first"><br><p><h1>Test!</p></h1></div><div id="second"><h2>Test 2!</h2></div>`
 
 func TestParsingSnippet(t *testing.T) {
-	doc, parseError := Parse(SNIPPET)
+	doc, parseError := ParseFragment(SNIPPET)
 	if parseError != nil {
 		t.Error(parseError.Error())
 		t.FailNow()
 	}
 
-	if len(doc.Children) == 0 {
+	if len(doc.Children()) == 0 {
 		t.Error("doc children length is 0")
 		t.FailNow()
 	}
 
-	if doc.Children[0].Attributes["id"] != "first" {
-		t.Errorf("Invalid first child: %s", doc.Children[0].ToString())
+	if doc.Children()[0].Attributes["id"] != "first" {
+		t.Errorf("Invalid first child: %s", doc.Children()[0].ToString())
 		t.FailNow()
 	}
 
-	if doc.Children[1].Attributes["id"] != "second" {
-		t.Errorf("Invalid first child: %s", doc.Children[1].ToString())
+	if doc.Children()[1].Attributes["id"] != "second" {
+		t.Errorf("Invalid first child: %s", doc.Children()[1].ToString())
 		t.FailNow()
 	}
 }
@@ -139,6 +143,61 @@ func TestParsingMocks(t *testing.T) {
 	}
 }
 
+func TestParseReader(t *testing.T) {
+	for _, mock_file := range []string{"news.ycombinator.com.html", "blendlabs.com.html"} {
+		file, open_err := os.Open("mocks/" + mock_file)
+		if open_err != nil {
+			t.Error(open_err.Error())
+			t.FailNow()
+		}
+		streamed, parse_err := ParseReader(file)
+		file.Close()
+		if parse_err != nil {
+			t.Errorf("error with %s: %s", mock_file, parse_err.Error())
+			t.FailNow()
+		}
+
+		parsed, _ := Parse(readFileContents("mocks/" + mock_file))
+		if !parsed.EqualTo(*streamed) {
+			t.Errorf("ParseReader and Parse disagree for %s", mock_file)
+			t.FailNow()
+		}
+	}
+
+	doc, parse_err := ParseReader(strings.NewReader("<div>text</div>tail"))
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+	body, _ := doc.QuerySelector("body")
+	if body == nil || len(body.Children()) != 2 || body.Children()[1].SourceHTML != "tail" {
+		t.Error("trailing text should be the last child")
+		t.FailNow()
+	}
+	if body.SourceHTML != EMPTY || body.Children()[0].Children()[0].SourceHTML != "text" {
+		t.Error("only text nodes should keep their source when parsing from a reader")
+		t.FailNow()
+	}
+
+	parsed, _ := Parse("<div>\xffé<b>x</b></div>")
+	if div, _ := parsed.QuerySelector("div"); div == nil || div.SourceHTML != "\xffé<b>x</b>" {
+		t.Error("an element parsed from a string should keep its inner html as it was written")
+		t.FailNow()
+	}
+
+	_, parse_err = ParseReader(io.MultiReader(strings.NewReader("<div>"), &failingReader{}))
+	if parse_err == nil || parse_err.Error() != "read failed" {
+		t.Error("ParseReader should return errors from the reader")
+		t.FailNow()
+	}
+}
+
+type failingReader struct{}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
 func TestParsingInvalid(t *testing.T) {
 	_, parseError := ParseStrict(SNIPPET_INVALID)
 	if parseError == nil {
@@ -217,10 +276,9 @@ func TestElementStack(t *testing.T) {
 }
 
 func TestReadUntilTag(t *testing.T) {
-	cursor := 0
 	valid := "      this is a test of reading until the tag <area/>"
 
-	results, results_err := readUntilTag([]rune(valid), &cursor)
+	results, results_err := readUntilTag(newRuneScanner(strings.NewReader(valid)))
 	if results_err != nil {
 		t.Error(results_err.Error())
 		t.FailNow()
@@ -231,10 +289,9 @@ func TestReadUntilTag(t *testing.T) {
 		t.FailNow()
 	}
 
-	cursor = 0
 	no_tag := "there is no tag."
 
-	results, results_err = readUntilTag([]rune(no_tag), &cursor)
+	results, results_err = readUntilTag(newRuneScanner(strings.NewReader(no_tag)))
 	if results_err != nil {
 		t.Error(results_err.Error())
 		t.FailNow()
@@ -244,9 +301,8 @@ func TestReadUntilTag(t *testing.T) {
 		t.FailNow()
 	}
 
-	cursor = 0
 	only_tag := "<a href='things.html'>things</a>"
-	results, results_err = readUntilTag([]rune(only_tag), &cursor)
+	results, results_err = readUntilTag(newRuneScanner(strings.NewReader(only_tag)))
 	if results_err != nil {
 		t.Error(results_err.Error())
 		t.FailNow()
@@ -256,9 +312,8 @@ func TestReadUntilTag(t *testing.T) {
 		t.FailNow()
 	}
 
-	cursor = 0
 	starts_tag := "<br/> more text ..."
-	results, results_err = readUntilTag([]rune(starts_tag), &cursor)
+	results, results_err = readUntilTag(newRuneScanner(strings.NewReader(starts_tag)))
 	if results_err != nil {
 		t.Error(results_err.Error())
 		t.FailNow()
@@ -269,55 +324,69 @@ func TestReadUntilTag(t *testing.T) {
 	}
 }
 
-func TestReadUntilScriptTagClose(t *testing.T) {
-	test_cases := map[string]string{
-		`var a = "abc";</script>`:      `var a = "abc";`,
-		`alert('</script>');</script>`: `alert('</script>');`,
-
-		`//</script>
-		var foo = "bar";
-		</script>`: `//</script>
-		var foo = "bar";
-		`,
-
-		`var foo = 'bar';
-		/* this is a block 
-		comment and is annoying */
-		foo = 'baz';
-		</script>`: `var foo = 'bar';
-		/* this is a block 
-		comment and is annoying */
-		foo = 'baz';
-		`,
-		`
-			function hide(id) {
-				var el = document.getElementById(id);
-				if (el) { el.style.visibility = 'hidden'; }
-			}
-		</script>`: `
-			function hide(id) {
-				var el = document.getElementById(id);
-				if (el) { el.style.visibility = 'hidden'; }
-			}
-		`,
-	}
-
-	for test, expected := range test_cases {
-		cursor := 0
-		results, results_err := readUntilScriptTagClose([]rune(test), &cursor, "text/javascript")
+func TestReadUntilScriptEnd(t *testing.T) {
+	test_cases := []struct {
+		script    string
+		expected  string
+		is_closed bool
+	}{
+		{`var a = "abc";</script>`, `var a = "abc";`, true},
+		{`alert('</script>');</script>`, `alert('`, true},
+		{"//</script>\nvar foo = \"bar\";\n</script>", `//`, true},
+		{"var foo = 'bar';\n/* this is a block\ncomment and is annoying */\nfoo = 'baz';\n</script>", "var foo = 'bar';\n/* this is a block\ncomment and is annoying */\nfoo = 'baz';\n", true},
+		{`var re = /"/; var s = '<div>';</script><p>after</p>`, `var re = /"/; var s = '<div>';`, true},
+		{`if (a<b && c</scripty) { d(); }</script>`, `if (a<b && c</scripty) { d(); }`, true},
+		{`x = "</SCRIPT >";</script>`, `x = "`, true},
+		{`x = 1;</script foo="bar">`, `x = 1;`, true},
+		{`{"name": "a</b>", "url": "http://x/'"}</script>`, `{"name": "a</b>", "url": "http://x/'"}`, true},
+		{`<!-- document.write("<script>x()</script>"); --></script>`, `<!-- document.write("<script>x()</script>"); -->`, true},
+		{`<!--<script>a</script>b</script>c`, `<!--<script>a</script>b`, true},
+		{`<!--<script>document.write('</scr'+'ipt>')--></script>`, `<!--<script>document.write('</scr'+'ipt>')-->`, true},
+		{`a = 1 <!-- b --> c</script>`, `a = 1 <!-- b --> c`, true},
+		{`<!-- a <b> c </script>`, `<!-- a <b> c `, true},
+		{`<!-->x</script>`, `<!-->x`, true},
+		{`<!--<script></script>`, `<!--<script></script>`, false},
+		{`var a = 1;`, `var a = 1;`, false},
+		{`a </scr`, `a </scr`, false},
+	}
+
+	for _, test_case := range test_cases {
+		results, is_closed, results_err := readUntilScriptEnd(newRuneScanner(strings.NewReader(test_case.script)))
 		if results_err != nil {
-			t.Error("error occurred.")
+			t.Error(results_err.Error())
 			t.FailNow()
-
 		}
-		if len(results) == 0 {
-			t.Error("empty results.")
-			t.FailNow()
+		if string(results) != test_case.expected || is_closed != test_case.is_closed {
+			t.Errorf("%q read as %q (closed: %v), expected %q (closed: %v)", test_case.script, string(results), is_closed, test_case.expected, test_case.is_closed)
 		}
+	}
+}
 
-		if expected != string(results) {
-			t.Errorf("expected: '%s' actual: '%s'", expected, string(results))
-			t.FailNow()
+func TestParseScripts(t *testing.T) {
+	scripts := map[string]string{
+		`<script type="module">import { a } from "./a.js"; if (a < 2 && "'") {}</script>`:    `import { a } from "./a.js"; if (a < 2 && "'") {}`,
+		`<script type="application/ld+json">{"@type": "Thing", "name": "it's <b>"}</script>`: `{"@type": "Thing", "name": "it's <b>"}`,
+		`<script>var re = /['"]/g; s.replace(re, "");</script>`:                              `var re = /['"]/g; s.replace(re, "");`,
+		`<script type="text/template"><div class="x">{{ name }}</div></script>`:              `<div class="x">{{ name }}</div>`,
+		`<script>document.write('<script src="x.js"><\/script>');</script>`:                  `document.write('<script src="x.js"><\/script>');`,
+		`<script><!--\ndocument.write("<script>a()</script>");\n//--></script>`:              `<!--\ndocument.write("<script>a()</script>");\n//-->`,
+		`<script>/* it's a comment with a quote */ var x = 1;</script>`:                      `/* it's a comment with a quote */ var x = 1;`,
+		`<script>// don't</script>`: `// don't`,
+	}
+
+	for body, expected := range scripts {
+		doc, parse_err := ParseStrict(body + "<p>after</p>")
+		if parse_err != nil {
+			t.Errorf("%s: %s", body, parse_err.Error())
+			continue
+		}
+		script, _ := doc.QuerySelector("script")
+		if script == nil || len(script.Children()) != 1 || script.Children()[0].SourceHTML != expected {
+			t.Errorf("%s parsed as %s", body, outline(doc))
+			continue
+		}
+		if after, _ := doc.QuerySelector("body > p"); after == nil || after.GetInnerText() != "after" {
+			t.Errorf("%s swallowed the rest of the document", body)
 		}
 	}
 }
@@ -369,9 +438,9 @@ func TestElementEqualTo(t *testing.T) {
 
 func TestReadTag(t *testing.T) {
 	testCases := map[string]Element{
-		"<!DOCTYPE>":                 Element{ElementName: ELEMENT_DOCTYPE, IsVoid: true, Attributes: map[string]string{}},
-		"<!DOCTYPE html>":            Element{ElementName: ELEMENT_DOCTYPE, IsVoid: true, Attributes: map[string]string{"html": ""}},
-		"<!-- this is a comment -->": Element{ElementName: ELEMENT_INTERNAL_XML_COMMENT, IsVoid: true, IsComment: true, InnerHTML: " this is a comment ", Attributes: map[string]string{}},
+		"<!DOCTYPE>":                 Element{ElementName: ELEMENT_DOCTYPE, IsVoid: true, IsDoctype: true, Doctype: &Doctype{ForceQuirks: true}, Attributes: map[string]string{}},
+		"<!DOCTYPE html>":            Element{ElementName: ELEMENT_DOCTYPE, IsVoid: true, IsDoctype: true, Doctype: &Doctype{Name: "html"}, Attributes: map[string]string{}},
+		"<!-- this is a comment -->": Element{ElementName: ELEMENT_INTERNAL_XML_COMMENT, IsVoid: true, IsComment: true, SourceHTML: " this is a comment ", Text: " this is a comment ", Attributes: map[string]string{}},
 		"<br>":                                                                    Element{ElementName: ELEMENT_BR, IsVoid: true, Attributes: map[string]string{}},
 		"<br/>":                                                                   Element{ElementName: ELEMENT_BR, IsVoid: true, Attributes: map[string]string{}},
 		"</div>":                                                                  Element{ElementName: ELEMENT_DIV, IsVoid: false, IsClose: true, Attributes: map[string]string{}},
@@ -387,8 +456,7 @@ func TestReadTag(t *testing.T) {
 	}
 
 	for tag, expectedResult := range testCases {
-		cursor := 0
-		actualResult, parseError := readTag([]rune(tag), &cursor)
+		actualResult, parseError := readTag(newRuneScanner(strings.NewReader(tag)))
 
 		if parseError != nil {
 			t.Error(parseError.Error())
@@ -429,7 +497,7 @@ func TestGetInnerText(t *testing.T) {
 		t.FailNow()
 	}
 
-	if len(h1.Children) == 0 {
+	if len(h1.Children()) == 0 {
 		t.Error("h1 has no children")
 		t.FailNow()
 	}
@@ -439,3 +507,99 @@ func readFileContents(filename string) string {
 	reader, _ := ioutil.ReadFile(filename)
 	return string(reader)
 }
+
+func TestPosition(t *testing.T) {
+	body := "<div>\n  <p class=\"intro\" id=a>Hé <b>there</b></p>\n</div>"
+	doc, parse_err := Parse(body)
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+
+	p, _ := doc.QuerySelector("p")
+	if p == nil {
+		t.Error("p element not found")
+		t.FailNow()
+	}
+	position := p.Position()
+	if position.Start != (Location{Offset: 8, Line: 2, Column: 3}) {
+		t.Errorf("p starts at %v", position.Start)
+	}
+	if raw := body[position.Start.Offset:position.End.Offset]; raw != `<p class="intro" id=a>Hé <b>there</b></p>` {
+		t.Errorf("p spans %q", raw)
+	}
+
+	b, _ := doc.QuerySelector("b")
+	if b.Position().Start.Column != 28 || b.Position().Start.Line != 2 {
+		t.Errorf("b starts at %s, expected 2:28", b.Position().Start)
+	}
+	if text := b.Children()[0].Position(); body[text.Start.Offset:text.End.Offset] != "there" {
+		t.Error("text nodes should have positions too")
+	}
+
+	class_position, has_class := p.AttributePosition("class")
+	if !has_class || body[class_position.Start.Offset:class_position.End.Offset] != `class="intro"` {
+		t.Errorf("class attribute position is %v", class_position)
+	}
+	id_position, _ := p.AttributePosition("ID")
+	if id_position.Start.Column != 20 || body[id_position.Start.Offset:id_position.End.Offset] != "id=a" {
+		t.Errorf("id attribute position is %v", id_position)
+	}
+	if _, has_missing := p.AttributePosition("missing"); has_missing {
+		t.Error("missing attributes should not have a position")
+	}
+
+	div, _ := doc.QuerySelector("div")
+	if div.Position().End.Offset != len(body) || doc.Position().End.Line != 3 {
+		t.Error("the div and root should end at the end of the input")
+	}
+}
+
+func TestTreeLinks(t *testing.T) {
+	doc, parse_err := ParseFragment("<div><ul><li>a</li><li><b>b</b></li><li>c</li></ul><p>d</p></div>")
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+
+	for _, node := range append([]*Element{doc}, doc.Flatten()...) {
+		for x, child := range node.Children() {
+			if child.Parent != node {
+				t.Errorf("the parent of %s is wrong", child.ToString())
+			}
+			if (x == 0) != (child.PrevSibling == nil) || (x > 0 && child.PrevSibling != node.Children()[x-1]) {
+				t.Errorf("the previous sibling of %s is wrong", child.ToString())
+			}
+			if (x == len(node.Children())-1) != (child.NextSibling == nil) || (x < len(node.Children())-1 && child.NextSibling != node.Children()[x+1]) {
+				t.Errorf("the next sibling of %s is wrong", child.ToString())
+			}
+		}
+		if len(node.Children()) > 0 && (node.FirstChild != node.Children()[0] || node.LastChild != node.Children()[len(node.Children())-1]) {
+			t.Errorf("the first and last children of %s are wrong", node.ToString())
+		}
+	}
+
+	b, _ := doc.QuerySelector("b")
+	path := []string{}
+	for _, ancestor := range b.GetPath() {
+		path = append(path, ancestor.ElementName)
+	}
+	if strings.Join(path, ",") != "li,ul,div" {
+		t.Errorf("the path of b is %v", path)
+	}
+	if b.Parent.PrevSibling.FirstChild.Text != "a" || b.Parent.NextSibling.FirstChild.Text != "c" {
+		t.Error("expected to walk from b to the other list items")
+	}
+
+	//changes through any reference to a node show up in the tree.
+	b.SetAttr("class", "bold")
+	if highlighted, _ := doc.QuerySelector("li > b.bold"); highlighted != b {
+		t.Error("QuerySelector should return the node in the tree")
+	}
+	if !strings.Contains(doc.Render(), `<b class="bold">`) {
+		t.Error("a change to a selected node should be rendered")
+	}
+	if items, _ := doc.QueryXpath("//li"); len(items) != 3 || items[1] != b.Parent {
+		t.Error("QueryXpath should return the nodes in the tree")
+	}
+}
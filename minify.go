@@ -0,0 +1,319 @@
+package html
+
+import (
+	"strings"
+)
+
+//--------------------------------------------------------------------------------
+// TYPES: MINIFY OPTIONS
+//--------------------------------------------------------------------------------
+
+// MinifyOptions turn off the parts of Minify that aren't wanted; the zero value minifies as much as it can.
+type MinifyOptions struct {
+	// KeepWhitespace writes text as it is instead of collapsing its whitespace.
+	KeepWhitespace bool
+	// KeepComments writes every comment.
+	KeepComments bool
+	// KeepConditionalComments writes `<!--[if IE]>...<![endif]-->` style comments while dropping the rest.
+	KeepConditionalComments bool
+	// KeepEndTags writes end tags the html spec lets a document leave out, like `</li>` and `</p>`.
+	KeepEndTags bool
+	// KeepAttributeQuotes quotes every attribute value, even ones that don't need it.
+	KeepAttributeQuotes bool
+}
+
+var (
+	// attributes whose value is just whether they're there.
+	BOOLEAN_ATTRIBUTES = map[string]bool{
+		"allowfullscreen": true, "async": true, "autofocus": true, "autoplay": true, "checked": true,
+		"controls": true, "default": true, "defer": true, "disabled": true, "formnovalidate": true,
+		"hidden": true, "inert": true, "ismap": true, "itemscope": true, "loop": true, "multiple": true,
+		"muted": true, "nomodule": true, "novalidate": true, "open": true, "playsinline": true,
+		"readonly": true, "required": true, "reversed": true, "selected": true,
+	}
+
+	// elements whose start tag closes an open `<p>`, so the `</p>` before them can be left out.
+	P_CLOSING_ELEMENTS = map[string]bool{
+		ELEMENT_ADDRESS: true, ELEMENT_ARTICLE: true, ELEMENT_ASIDE: true, ELEMENT_BLOCKQUOTE: true,
+		ELEMENT_DETAILS: true, ELEMENT_DIALOG: true, ELEMENT_DIV: true, ELEMENT_DL: true, ELEMENT_FIELDSET: true,
+		ELEMENT_FIGCAPTION: true, ELEMENT_FIGURE: true, ELEMENT_FOOTER: true, ELEMENT_FORM: true,
+		ELEMENT_H1: true, ELEMENT_H2: true, ELEMENT_H3: true, ELEMENT_H4: true, ELEMENT_H5: true, ELEMENT_H6: true,
+		ELEMENT_HEADER: true, ELEMENT_HGROUP: true, ELEMENT_HR: true, ELEMENT_MAIN: true, ELEMENT_MENU: true,
+		ELEMENT_NAV: true, ELEMENT_OL: true, ELEMENT_P: true, ELEMENT_PRE: true, ELEMENT_SECTION: true,
+		ELEMENT_TABLE: true, ELEMENT_UL: true,
+	}
+
+	// elements besides CLOSES_PARAGRAPH_ELEMENTS that are laid out as blocks (or not at all), so whitespace next
+	// to them doesn't show. Anything else, like a textarea or video, sits in a line of text.
+	BLOCK_ELEMENTS = map[string]bool{
+		ELEMENT_HTML: true, ELEMENT_HEAD: true, ELEMENT_BODY: true, ELEMENT_TITLE: true, ELEMENT_META: true,
+		ELEMENT_BASE: true, ELEMENT_LINK: true, ELEMENT_STYLE: true, ELEMENT_CAPTION: true, ELEMENT_COLGROUP: true,
+		ELEMENT_COL: true, ELEMENT_THEAD: true, ELEMENT_TBODY: true, ELEMENT_TFOOT: true, ELEMENT_TR: true,
+		ELEMENT_TD: true, ELEMENT_TH: true, ELEMENT_LEGEND: true, ELEMENT_OPTGROUP: true, ELEMENT_OPTION: true,
+	}
+
+	// a `</p>` that ends one of these can't be left out.
+	P_END_TAG_PARENTS = map[string]bool{
+		ELEMENT_A: true, ELEMENT_AUDIO: true, ELEMENT_DEL: true, ELEMENT_INS: true, ELEMENT_MAP: true,
+		ELEMENT_NOSCRIPT: true, ELEMENT_VIDEO: true,
+	}
+)
+
+// Minify returns the element as html with everything that doesn't change the document taken out.
+func (e Element) Minify(opts MinifyOptions) string {
+	out := &strings.Builder{}
+	m := &minifier{hw: &htmlWriter{w: out}, opts: opts, top: &e}
+	m.writeNode(&e)
+	return out.String()
+}
+
+//--------------------------------------------------------------------------------
+// MINIFICATION
+//--------------------------------------------------------------------------------
+
+type minifier struct {
+	hw   *htmlWriter
+	opts MinifyOptions
+	top  *Element // what's being minified, which always gets its end tag.
+}
+
+func (m *minifier) writeNode(e *Element) {
+	switch {
+	case e.IsRoot:
+		m.writeChildren(e)
+	case e.IsText:
+		m.hw.WriteString(m.text(e))
+	case e.IsComment:
+		if !m.dropped(e) {
+			m.hw.WriteString("<!--" + e.Text + "-->")
+		}
+	case e.IsDoctype, e.IsCData, e.IsProcessingInstruction:
+		m.hw.writeNode(e)
+	default:
+		m.writeElement(e)
+	}
+}
+
+func (m *minifier) writeElement(e *Element) {
+	m.hw.WriteString("<" + e.ElementName)
+	unquoted := false
+	for _, attr := range serializedAttributes(e) {
+		m.hw.WriteString(" " + m.attribute(e, attr))
+		unquoted = !m.opts.KeepAttributeQuotes && canBeUnquoted(attr.Value)
+	}
+
+	if isForeignNamespace(e.Namespace) && e.FirstChild == nil && e.IsVoid {
+		if unquoted {
+			m.hw.WriteString(" ") // or the slash would be read as part of the value.
+		}
+		m.hw.WriteString("/>")
+		return
+	}
+	m.hw.WriteString(">")
+	if !isForeignNamespace(e.Namespace) && isKnownVoidElement(e.ElementName) {
+		return
+	}
+	m.hw.WriteString(leadingNewline(e))
+	m.writeChildren(e)
+	if m.opts.KeepEndTags || !m.canOmitEndTag(e) {
+		m.hw.WriteString(endTag(e))
+	}
+}
+
+func (m *minifier) writeChildren(e *Element) {
+	for child := e.FirstChild; child != nil && m.hw.err == nil; child = child.NextSibling {
+		m.writeNode(child)
+	}
+}
+
+// attribute writes `attr` with as little as it takes: boolean attributes lose their value and quotes
+// are left off where they aren't needed.
+func (m *minifier) attribute(e *Element, attr Attribute) string {
+	if len(attr.Value) == 0 {
+		return attr.Name
+	}
+	if !isForeignNamespace(e.Namespace) && BOOLEAN_ATTRIBUTES[attr.Name] && strings.EqualFold(attr.Value, attr.Name) {
+		return attr.Name
+	}
+	if !m.opts.KeepAttributeQuotes && canBeUnquoted(attr.Value) {
+		return attr.Name + "=" + attr.Value
+	}
+	if strings.Contains(attr.Value, "\"") && !strings.Contains(attr.Value, "'") {
+		return attr.Name + "='" + SINGLE_QUOTE_ATTRIBUTE_ESCAPER.Replace(attr.Value) + "'"
+	}
+	return attr.Name + "=\"" + ATTRIBUTE_ESCAPER.Replace(attr.Value) + "\""
+}
+
+// text collapses runs of whitespace to a space, dropping it altogether next to the start or end of a block.
+func (m *minifier) text(e *Element) string {
+	if isRawTextParent(e.Parent) {
+		return e.Text
+	}
+	text := TEXT_ESCAPER.Replace(e.Text)
+	if m.opts.KeepWhitespace || m.preservesWhitespace(e.Parent) {
+		return text
+	}
+
+	collapsed := &strings.Builder{}
+	in_whitespace := false
+	for _, c := range text {
+		if isWhitespace(c) {
+			if !in_whitespace {
+				collapsed.WriteRune(' ')
+			}
+			in_whitespace = true
+			continue
+		}
+		in_whitespace = false
+		collapsed.WriteRune(c)
+	}
+	text = collapsed.String()
+
+	//whitespace running on from the text before, with only dropped comments between, was already written there.
+	previous := m.previous(e)
+	if m.isBlockBoundary(previous, e.Parent) || (previous != nil && previous.IsText && endsWithWhitespace(previous.Text)) {
+		text = strings.TrimPrefix(text, " ")
+	}
+	if m.isBlockBoundary(m.nextAfterWhitespace(e), e.Parent) {
+		text = strings.TrimSuffix(text, " ")
+	}
+	return text
+}
+
+// nextAfterWhitespace is the next sibling past any text that's only whitespace, which collapses into the text before it.
+func (m *minifier) nextAfterWhitespace(e *Element) *Element {
+	sibling := m.next(e)
+	for sibling != nil && sibling.IsText && isContinuousWhitespace([]rune(sibling.Text)) {
+		sibling = m.next(sibling)
+	}
+	return sibling
+}
+
+func endsWithWhitespace(text string) bool {
+	return len(text) > 0 && isWhitespace(rune(text[len(text)-1]))
+}
+
+// isBlockBoundary returns if whitespace next to `sibling` (or next to the start or end of `parent` when
+// there's no sibling) is insignificant.
+func (m *minifier) isBlockBoundary(sibling, parent *Element) bool {
+	if sibling == nil {
+		return parent == nil || m.isBlock(parent)
+	}
+	return m.isBlock(sibling)
+}
+
+func (m *minifier) isBlock(e *Element) bool {
+	if e.IsRoot || e.IsDoctype {
+		return true
+	}
+	return isElementNode(e) && !isForeignNamespace(e.Namespace) && (CLOSES_PARAGRAPH_ELEMENTS[e.ElementName] || BLOCK_ELEMENTS[e.ElementName])
+}
+
+func (m *minifier) preservesWhitespace(e *Element) bool {
+	for ; e != nil; e = e.Parent {
+		if !isForeignNamespace(e.Namespace) && PRESERVE_WHITESPACE_ELEMENTS[e.ElementName] {
+			return true
+		}
+	}
+	return false
+}
+
+// dropped returns if the minified output leaves the node out entirely.
+func (m *minifier) dropped(e *Element) bool {
+	if e.IsComment {
+		return !m.opts.KeepComments && !(m.opts.KeepConditionalComments && isConditionalComment(e.Text))
+	}
+	if e.IsText {
+		return len(m.text(e)) == 0
+	}
+	return false
+}
+
+// previous and next skip over the comments that are dropped, which can leave text next to text.
+func (m *minifier) previous(e *Element) *Element {
+	sibling := e.PrevSibling
+	for sibling != nil && sibling.IsComment && m.dropped(sibling) {
+		sibling = sibling.PrevSibling
+	}
+	return sibling
+}
+
+func (m *minifier) next(e *Element) *Element {
+	sibling := e.NextSibling
+	for sibling != nil && sibling.IsComment && m.dropped(sibling) {
+		sibling = sibling.NextSibling
+	}
+	return sibling
+}
+
+// nextWritten is the next sibling that's written at all, so whitespace dropped by Minify doesn't count.
+func (m *minifier) nextWritten(e *Element) *Element {
+	sibling := m.next(e)
+	for sibling != nil && m.dropped(sibling) {
+		sibling = m.next(sibling)
+	}
+	return sibling
+}
+
+// canOmitEndTag follows the optional tag rules of the html spec.
+func (m *minifier) canOmitEndTag(e *Element) bool {
+	if isForeignNamespace(e.Namespace) || e == m.top {
+		return false
+	}
+	if (e.Parent == nil || e.Parent.IsRoot) && e.ElementName != ELEMENT_HTML {
+		return false // a fragment might be put in front of more html.
+	}
+	next := m.nextWritten(e)
+	next_is := func(names ...string) bool {
+		if next == nil || !isElementNode(next) || isForeignNamespace(next.Namespace) {
+			return false
+		}
+		for _, name := range names {
+			if next.ElementName == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch e.ElementName {
+	case ELEMENT_HTML, ELEMENT_BODY:
+		return next == nil || !next.IsComment
+	case ELEMENT_HEAD, ELEMENT_COLGROUP, ELEMENT_CAPTION:
+		return next == nil || isElementNode(next)
+	case ELEMENT_LI:
+		return next == nil || next_is(ELEMENT_LI)
+	case ELEMENT_DT:
+		return next_is(ELEMENT_DT, ELEMENT_DD)
+	case ELEMENT_DD:
+		return next == nil || next_is(ELEMENT_DT, ELEMENT_DD)
+	case ELEMENT_P:
+		if next == nil {
+			return !P_END_TAG_PARENTS[e.Parent.ElementName]
+		}
+		return (isElementNode(next) && !isForeignNamespace(next.Namespace) && P_CLOSING_ELEMENTS[next.ElementName])
+	case ELEMENT_RT, ELEMENT_RP:
+		return next == nil || next_is(ELEMENT_RT, ELEMENT_RP)
+	case ELEMENT_OPTGROUP:
+		return next == nil || next_is(ELEMENT_OPTGROUP, ELEMENT_HR)
+	case ELEMENT_OPTION:
+		return next == nil || next_is(ELEMENT_OPTION, ELEMENT_OPTGROUP, ELEMENT_HR)
+	case ELEMENT_THEAD:
+		return next_is(ELEMENT_TBODY, ELEMENT_TFOOT)
+	case ELEMENT_TBODY:
+		return next == nil || next_is(ELEMENT_TBODY, ELEMENT_TFOOT)
+	case ELEMENT_TFOOT:
+		return next == nil
+	case ELEMENT_TR:
+		return next == nil || next_is(ELEMENT_TR)
+	case ELEMENT_TD, ELEMENT_TH:
+		return next == nil || next_is(ELEMENT_TD, ELEMENT_TH)
+	}
+	return false
+}
+
+// isConditionalComment returns if a comment's data is one of internet explorer's conditional comments.
+func isConditionalComment(data string) bool {
+	data = strings.TrimSpace(data)
+	return strings.HasPrefix(data, "[if ") || strings.HasPrefix(data, "<![endif]") || strings.HasSuffix(data, "<![endif]")
+}
@@ -0,0 +1,75 @@
+package html
+
+import (
+	"testing"
+)
+
+func TestMinify(t *testing.T) {
+	testCases := map[string]string{
+		"<div>\n  <p class=\"lead\">Hello <b>big</b>   world</p>\n</div>":    `<div><p class=lead>Hello <b>big</b> world</div>`,
+		`<ul> <li>one</li> <li>two</li> </ul>`:                               `<ul><li>one<li>two</ul>`,
+		`<p>a</p><p>b</p><span>c</span>`:                                     `<p>a</p><p>b</p><span>c</span>`,
+		`<div><p>a</p><p>b</p>text</div>`:                                    `<div><p>a<p>b</p>text</div>`,
+		`<a href="/x"><p>a</p></a>`:                                          `<a href=/x><p>a</p></a>`,
+		`<input type="checkbox" checked="checked" disabled="" value="a b">`:  `<input type=checkbox checked disabled value="a b">`,
+		`<p title='say "hi"'>x<!-- note -->y</p>`:                            `<p title='say "hi"'>xy</p>`,
+		`<table><tr><td>a</td><td>b</td></tr></table>`:                       `<table><tbody><tr><td>a<td>b</table>`,
+		`<select><option>a</option><option>b</option></select>`:              `<select><option>a<option>b</select>`,
+		`<pre>  keep   this </pre>`:                                          `<pre>  keep   this </pre>`,
+		`<script> if (a  <  b) { go() } </script>`:                           `<script> if (a  <  b) { go() } </script>`,
+		`<svg><circle r="1"/><path d="M0 0"/></svg>`:                         `<svg><circle r=1 /><path d="M0 0"/></svg>`,
+		`<label>Name <textarea>x</textarea> more</label>`:                    `<label>Name <textarea>x</textarea> more</label>`,
+		`<p>Pick <select> <option>a</option> </select> now</p>`:              `<p>Pick <select><option>a</select> now</p>`,
+		`<p>See <video src="a.mp4"></video> here</p>`:                        `<p>See <video src=a.mp4></video> here</p>`,
+		`<p>a <audio></audio> <iframe></iframe> <canvas></canvas> b</p>`:     `<p>a <audio></audio> <iframe></iframe> <canvas></canvas> b</p>`,
+		`<p>a <object></object> <embed> c</p>`:                               `<p>a <object></object> <embed> c</p>`,
+		`<p>a <meter></meter> <progress></progress> <output></output> b</p>`: `<p>a <meter></meter> <progress></progress> <output></output> b</p>`,
+	}
+
+	for input, expected := range testCases {
+		doc, _ := ParseFragment(input)
+		if actual := doc.Minify(MinifyOptions{}); actual != expected {
+			t.Errorf("%s minified as %s, expected %s", input, actual, expected)
+		}
+	}
+
+	doc, _ := Parse("<!DOCTYPE html><html><head><title>a</title><!--[if IE]><p>ie<![endif]--><!-- b --></head><body><p>c</p></body></html>")
+	if actual := doc.Minify(MinifyOptions{}); actual != `<!DOCTYPE html><html><head><title>a</title><body><p>c` {
+		t.Errorf("document minified as %s", actual)
+	}
+	if actual := doc.Minify(MinifyOptions{KeepConditionalComments: true}); actual != `<!DOCTYPE html><html><head><title>a</title><!--[if IE]><p>ie<![endif]--><body><p>c` {
+		t.Errorf("document minified as %s", actual)
+	}
+
+	keep_all := MinifyOptions{KeepWhitespace: true, KeepComments: true, KeepEndTags: true, KeepAttributeQuotes: true}
+	fragment, _ := ParseFragment("<ul>\n <li class=\"a\">one <!-- x --></li>\n</ul>")
+	if actual := fragment.Minify(keep_all); actual != fragment.OuterHTML() {
+		t.Errorf("keeping everything minified as %s", actual)
+	}
+
+	if li, _ := fragment.QuerySelector("li"); li.Minify(MinifyOptions{}) != "<li class=a>one</li>" {
+		t.Errorf("a single element should keep its end tag, got %s", li.Minify(MinifyOptions{}))
+	}
+}
+
+func TestMinifyRoundTrip(t *testing.T) {
+	for _, mock_file := range []string{"blendlabs.com.html", "news.ycombinator.com.html", "nytimes.com.html"} {
+		doc, _ := Parse(readFileContents("mocks/" + mock_file))
+		minified := doc.Minify(MinifyOptions{})
+		if len(minified) >= len(doc.OuterHTML()) {
+			t.Errorf("%s didn't get any smaller", mock_file)
+		}
+
+		reparsed, parse_err := Parse(minified)
+		if parse_err != nil {
+			t.Errorf("%s: %s", mock_file, parse_err.Error())
+			continue
+		}
+		if elementOutline(reparsed) != elementOutline(doc) {
+			t.Errorf("%s parsed into a different tree once minified", mock_file)
+		}
+		if reparsed.Minify(MinifyOptions{}) != minified {
+			t.Errorf("%s minified differently the second time", mock_file)
+		}
+	}
+}
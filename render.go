@@ -0,0 +1,401 @@
+package html
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+//--------------------------------------------------------------------------------
+// TYPES: RENDER OPTIONS
+//--------------------------------------------------------------------------------
+
+// SelfClosingStyle is how Render ends the tag of a void element.
+type SelfClosingStyle int
+
+const (
+	// `<br/>`
+	SELF_CLOSING_SLASH SelfClosingStyle = iota
+	// `<br />`
+	SELF_CLOSING_SPACED_SLASH
+	// `<br>`
+	SELF_CLOSING_NONE
+)
+
+// AttributeQuoting is the quote Render writes attribute values in.
+type AttributeQuoting int
+
+const (
+	QUOTE_DOUBLE AttributeQuoting = iota
+	QUOTE_SINGLE
+	// keep each attribute's quotes from the source, including none at all where the value allows it.
+	QUOTE_ORIGINAL
+)
+
+// RenderOptions control how Render lays out html. The zero value puts every node on its own line
+// with no indentation; DEFAULT_RENDER_OPTIONS is what Render uses.
+type RenderOptions struct {
+	// Indent is written once for each level of nesting.
+	Indent string
+	// MaxLineWidth is the width lines are kept within, where they can be broken; 0 means no limit.
+	MaxLineWidth int
+	// InlineElements keeps text and inline elements like `<a>` and `<b>` together on lines, wrapped at
+	// MaxLineWidth, instead of giving each one its own line.
+	InlineElements bool
+	// PreserveWhitespace writes the contents of `<pre>`, `<textarea>`, `<script>` and `<style>` exactly as they are.
+	PreserveWhitespace bool
+	// WrapAttributes puts each attribute of a start tag wider than MaxLineWidth on its own line.
+	WrapAttributes bool
+	SelfClosing    SelfClosingStyle
+	Quote          AttributeQuoting
+}
+
+var (
+	DEFAULT_RENDER_OPTIONS = RenderOptions{Indent: "  "}
+
+	// elements Render keeps on a line with the text around them when InlineElements is set.
+	INLINE_ELEMENTS = map[string]bool{
+		ELEMENT_A: true, ELEMENT_ABBR: true, ELEMENT_B: true, ELEMENT_BDI: true, "bdo": true, ELEMENT_BR: true,
+		ELEMENT_BUTTON: true, ELEMENT_CITE: true, ELEMENT_CODE: true, ELEMENT_DATA: true, ELEMENT_DFN: true,
+		ELEMENT_EM: true, ELEMENT_I: true, ELEMENT_IMG: true, ELEMENT_INPUT: true, ELEMENT_KBD: true,
+		ELEMENT_LABEL: true, ELEMENT_MARK: true, ELEMENT_Q: true, ELEMENT_S: true, ELEMENT_SAMP: true,
+		ELEMENT_SMALL: true, ELEMENT_SPAN: true, ELEMENT_STRONG: true, ELEMENT_SUB: true, ELEMENT_SUP: true,
+		ELEMENT_TIME: true, ELEMENT_U: true, ELEMENT_VAR: true, ELEMENT_WBR: true, ELEMENT_DEL: true,
+		ELEMENT_INS: true,
+	}
+
+	// elements whose contents Render leaves alone when PreserveWhitespace is set.
+	PRESERVE_WHITESPACE_ELEMENTS = map[string]bool{
+		ELEMENT_PRE: true, ELEMENT_TEXTAREA: true, "listing": true, "xmp": true, "plaintext": true,
+		ELEMENT_SCRIPT: true, ELEMENT_STYLE: true,
+	}
+
+	SINGLE_QUOTE_ATTRIBUTE_ESCAPER = strings.NewReplacer("&", "&amp;", "\u00a0", "&nbsp;", "'", "&#39;")
+)
+
+// RenderWithOptions returns the element as formatted html, laid out by `opts`.
+func (e Element) RenderWithOptions(opts RenderOptions) string {
+	out := &strings.Builder{}
+	e.RenderWithOptionsTo(out, opts)
+	return out.String()
+}
+
+// RenderWithOptionsTo writes the element to `w` the way RenderWithOptions does, through a buffer.
+func (e Element) RenderWithOptionsTo(w io.Writer, opts RenderOptions) error {
+	buffered := bufio.NewWriter(w)
+	r := &renderer{hw: &htmlWriter{w: buffered}, opts: opts}
+	if e.IsRoot {
+		r.renderChildren(&e, 0)
+	} else {
+		r.renderNode(&e, 0)
+	}
+	if r.hw.err != nil {
+		return r.hw.err
+	}
+	return buffered.Flush()
+}
+
+//--------------------------------------------------------------------------------
+// RENDERING
+//--------------------------------------------------------------------------------
+
+// a hard line break in a run of inline words, from a `<br>`.
+const renderLineBreak = ""
+
+type renderer struct {
+	hw   *htmlWriter
+	opts RenderOptions
+}
+
+func (r *renderer) line(depth int, content string) {
+	r.hw.WriteString(strings.Repeat(r.opts.Indent, depth))
+	r.hw.WriteString(content)
+	r.hw.WriteString("\n")
+}
+
+func (r *renderer) renderNode(e *Element, depth int) {
+	switch {
+	case e.IsRoot:
+		r.renderChildren(e, depth)
+	case e.IsText:
+		if text := trimString(r.text(e)); len(text) > 0 {
+			r.line(depth, text)
+		}
+	case e.IsComment, e.IsDoctype, e.IsCData, e.IsProcessingInstruction:
+		out := &strings.Builder{}
+		(&htmlWriter{w: out}).writeNode(e)
+		r.line(depth, out.String())
+	default:
+		r.renderElement(e, depth)
+	}
+}
+
+func (r *renderer) renderElement(e *Element, depth int) {
+	start := r.startTag(e, depth)
+	if r.isVoid(e) {
+		r.lines(depth, start)
+		return
+	}
+	end := endTag(e)
+
+	if r.opts.PreserveWhitespace && !isForeignNamespace(e.Namespace) && PRESERVE_WHITESPACE_ELEMENTS[e.ElementName] {
+		start[len(start)-1] += leadingNewline(e) + r.serializeChildren(e)
+		start[len(start)-1] += end
+		r.lines(depth, start)
+		return
+	}
+
+	if e.FirstChild == nil {
+		start[len(start)-1] += end
+		r.lines(depth, start)
+		return
+	}
+
+	if r.opts.InlineElements && r.hasInlineContent(e) {
+		words := r.inlineWords(e.Children())
+		one_line := start[len(start)-1] + strings.Join(words, " ") + end
+		if len(start) == 1 && !hasLineBreak(words) && r.fits(depth, one_line) {
+			r.line(depth, one_line)
+			return
+		}
+		r.lines(depth, start)
+		r.fill(depth+1, words)
+		r.line(depth, end)
+		return
+	}
+
+	r.lines(depth, start)
+	r.renderChildren(e, depth+1)
+	r.line(depth, end)
+}
+
+func (r *renderer) renderChildren(e *Element, depth int) {
+	if !r.opts.InlineElements {
+		for child := e.FirstChild; child != nil && r.hw.err == nil; child = child.NextSibling {
+			r.renderNode(child, depth)
+		}
+		return
+	}
+
+	run := []*Element{}
+	for child := e.FirstChild; child != nil && r.hw.err == nil; child = child.NextSibling {
+		if r.isInline(child) {
+			run = append(run, child)
+			continue
+		}
+		r.fill(depth, r.inlineWords(run))
+		run = run[:0]
+		r.renderNode(child, depth)
+	}
+	r.fill(depth, r.inlineWords(run))
+}
+
+// lines writes the lines of a (possibly wrapped) tag.
+func (r *renderer) lines(depth int, tag_lines []string) {
+	for x, content := range tag_lines {
+		if x == 0 {
+			r.line(depth, content)
+		} else {
+			r.line(depth+1, content)
+		}
+	}
+}
+
+// fill writes inline words as lines no wider than MaxLineWidth, breaking only between words.
+func (r *renderer) fill(depth int, words []string) {
+	indent_width := utf8.RuneCountInString(strings.Repeat(r.opts.Indent, depth))
+	current := &strings.Builder{}
+	width := 0
+	flush := func() {
+		if current.Len() > 0 {
+			r.line(depth, current.String())
+		}
+		current.Reset()
+		width = 0
+	}
+
+	for _, word := range words {
+		if word == renderLineBreak {
+			flush()
+			continue
+		}
+		word_width := utf8.RuneCountInString(word)
+		if current.Len() > 0 && r.opts.MaxLineWidth > 0 && indent_width+width+1+word_width > r.opts.MaxLineWidth {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteString(" ")
+			width++
+		}
+		current.WriteString(word)
+		width += word_width
+	}
+	flush()
+}
+
+func (r *renderer) fits(depth int, content string) bool {
+	if r.opts.MaxLineWidth <= 0 {
+		return true
+	}
+	return utf8.RuneCountInString(strings.Repeat(r.opts.Indent, depth)+content) <= r.opts.MaxLineWidth
+}
+
+// inlineWords splits inline nodes into words at the whitespace in their text; tags stick to the words around them.
+func (r *renderer) inlineWords(nodes []*Element) []string {
+	words := []string{}
+	word := &strings.Builder{}
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+
+	var add func(e *Element)
+	add = func(e *Element) {
+		if e.IsText {
+			for _, c := range r.text(e) {
+				if isWhitespace(c) {
+					flush()
+				} else {
+					word.WriteRune(c)
+				}
+			}
+			return
+		}
+		word.WriteString(strings.Join(r.startTag(e, -1), EMPTY))
+		if r.isVoid(e) {
+			if e.ElementName == ELEMENT_BR {
+				flush()
+				words = append(words, renderLineBreak)
+			}
+			return
+		}
+		for child := e.FirstChild; child != nil; child = child.NextSibling {
+			add(child)
+		}
+		word.WriteString("</" + e.ElementName + ">")
+	}
+
+	for _, e := range nodes {
+		add(e)
+	}
+	flush()
+	return words
+}
+
+// startTag returns the element's start tag, split into lines if its attributes need wrapping.
+// A negative depth means the tag is never wrapped.
+func (r *renderer) startTag(e *Element, depth int) []string {
+	attributes := []string{}
+	for _, attr := range serializedAttributes(e) {
+		attributes = append(attributes, r.attribute(attr))
+	}
+	closing := ">"
+	if r.isVoid(e) {
+		switch {
+		case r.opts.SelfClosing == SELF_CLOSING_SPACED_SLASH:
+			closing = " />"
+		case r.opts.SelfClosing == SELF_CLOSING_SLASH || isForeignNamespace(e.Namespace):
+			// svg and mathml need the slash, there's no end tag coming.
+			closing = "/>"
+		}
+	}
+
+	tag := "<" + e.ElementName
+	if len(attributes) > 0 {
+		tag = tag + " " + strings.Join(attributes, " ")
+	}
+	if depth < 0 || !r.opts.WrapAttributes || len(attributes) < 2 || r.fits(depth, tag+closing) {
+		return []string{tag + closing}
+	}
+
+	tag_lines := []string{"<" + e.ElementName}
+	tag_lines = append(tag_lines, attributes...)
+	tag_lines[len(tag_lines)-1] += strings.TrimPrefix(closing, " ")
+	return tag_lines
+}
+
+func (r *renderer) attribute(attr Attribute) string {
+	if len(attr.Value) == 0 {
+		return attr.Name
+	}
+	quote := r.opts.Quote
+	if quote == QUOTE_ORIGINAL {
+		switch {
+		case attr.Quote == '\'':
+			quote = QUOTE_SINGLE
+		case attr.Quote == 0 && canBeUnquoted(attr.Value):
+			return attr.Name + "=" + attr.Value
+		default:
+			quote = QUOTE_DOUBLE
+		}
+	}
+	if quote == QUOTE_SINGLE {
+		return attr.Name + "='" + SINGLE_QUOTE_ATTRIBUTE_ESCAPER.Replace(attr.Value) + "'"
+	}
+	return attr.Name + "=\"" + ATTRIBUTE_ESCAPER.Replace(attr.Value) + "\""
+}
+
+func (r *renderer) text(e *Element) string {
+	if isRawTextParent(e.Parent) {
+		return e.Text
+	}
+	return TEXT_ESCAPER.Replace(e.Text)
+}
+
+func (r *renderer) serializeChildren(e *Element) string {
+	out := &strings.Builder{}
+	(&htmlWriter{w: out}).writeChildren(e)
+	return out.String()
+}
+
+func (r *renderer) isVoid(e *Element) bool {
+	if isForeignNamespace(e.Namespace) {
+		return e.IsVoid && e.FirstChild == nil
+	}
+	return isKnownVoidElement(e.ElementName)
+}
+
+// isInline returns if a node can share a line with the text around it: text, and inline elements holding only those.
+func (r *renderer) isInline(e *Element) bool {
+	if e.IsText {
+		return true
+	}
+	if !isElementNode(e) || isForeignNamespace(e.Namespace) || !INLINE_ELEMENTS[e.ElementName] {
+		return false
+	}
+	return r.hasInlineContent(e)
+}
+
+func (r *renderer) hasInlineContent(e *Element) bool {
+	for child := e.FirstChild; child != nil; child = child.NextSibling {
+		if !r.isInline(child) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasLineBreak(words []string) bool {
+	for _, word := range words {
+		if word == renderLineBreak {
+			return true
+		}
+	}
+	return false
+}
+
+// canBeUnquoted returns if an attribute value can be written without quotes.
+func canBeUnquoted(value string) bool {
+	if len(value) == 0 {
+		return false
+	}
+	for _, c := range value {
+		if isWhitespace(c) || strings.ContainsRune("\"'=<>`&\u00a0", c) {
+			return false
+		}
+	}
+	return true
+}
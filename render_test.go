@@ -0,0 +1,136 @@
+package html
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	doc, _ := ParseFragment(`<div class="a"><p>one <b>two</b></p><br><!-- note --></div>`)
+	expected := strings.Join([]string{
+		`<div class="a">`,
+		`  <p>`,
+		`    one`,
+		`    <b>`,
+		`      two`,
+		`    </b>`,
+		`  </p>`,
+		`  <br/>`,
+		`  <!-- note -->`,
+		`</div>`,
+		``,
+	}, "\n")
+	if actual := doc.Render(); actual != expected {
+		t.Errorf("rendered as:\n%s", actual)
+	}
+
+	if p, _ := doc.QuerySelector("p"); !strings.HasPrefix(p.Render(), "<p>\n  one\n") {
+		t.Errorf("a single element should render from nesting 0, got:\n%s", p.Render())
+	}
+}
+
+func TestRenderOptions(t *testing.T) {
+	doc, _ := ParseFragment(`<div id=main class='box' title="a long title"><p>Some <a href="/x">linked</a> text that goes on for a while.<br>Next line</p><img src=a.png><svg><circle r="1"/></svg><pre>  keep
+   this</pre></div>`)
+
+	opts := RenderOptions{
+		Indent:             "\t",
+		MaxLineWidth:       32,
+		InlineElements:     true,
+		PreserveWhitespace: true,
+		WrapAttributes:     true,
+		SelfClosing:        SELF_CLOSING_NONE,
+		Quote:              QUOTE_ORIGINAL,
+	}
+	expected := strings.Join([]string{
+		`<div`,
+		"\tid=main",
+		"\tclass='box'",
+		"\ttitle=\"a long title\">",
+		"\t<p>",
+		"\t\tSome <a href=\"/x\">linked</a>",
+		"\t\ttext that goes on for a",
+		"\t\twhile.<br>",
+		"\t\tNext line",
+		"\t</p>",
+		"\t<img src=a.png>",
+		"\t<svg>",
+		"\t\t<circle r=\"1\"/>",
+		"\t</svg>",
+		"\t<pre>  keep\n   this</pre>",
+		`</div>`,
+		``,
+	}, "\n")
+	if actual := doc.RenderWithOptions(opts); actual != expected {
+		t.Errorf("rendered as:\n%s", actual)
+	}
+
+	short, _ := ParseFragment(`<p class="x">a <em>b</em> c</p><input disabled value="it's">`)
+	expected = "<p class='x'>a <em>b</em> c</p>\n<input disabled value='it&#39;s' />\n"
+	actual := short.RenderWithOptions(RenderOptions{InlineElements: true, SelfClosing: SELF_CLOSING_SPACED_SLASH, Quote: QUOTE_SINGLE})
+	if actual != expected {
+		t.Errorf("rendered as:\n%s", actual)
+	}
+}
+
+func TestRenderRoundTrip(t *testing.T) {
+	opts := RenderOptions{Indent: "  ", MaxLineWidth: 100, InlineElements: true, PreserveWhitespace: true, WrapAttributes: true}
+	for _, mock_file := range []string{"blendlabs.com.html", "news.ycombinator.com.html", "nytimes.com.html"} {
+		doc, _ := Parse(readFileContents("mocks/" + mock_file))
+		formatted := doc.RenderWithOptions(opts)
+
+		reparsed, parse_err := Parse(formatted)
+		if parse_err != nil {
+			t.Errorf("%s: %s", mock_file, parse_err.Error())
+			continue
+		}
+		if elementOutline(reparsed) != elementOutline(doc) {
+			t.Errorf("%s parsed into a different tree once formatted", mock_file)
+		}
+		if reparsed.RenderWithOptions(opts) != formatted {
+			t.Errorf("%s formatted differently the second time", mock_file)
+		}
+	}
+}
+
+// elementOutline is outline without the text, which formatting is free to re-flow, or the comments.
+func elementOutline(e *Element) string {
+	children := []string{}
+	for _, child := range e.Children() {
+		if !child.IsText && !child.IsComment {
+			children = append(children, elementOutline(child))
+		}
+	}
+	return e.ElementName + "(" + strings.Join(children, ",") + ")"
+}
+
+func TestRenderTo(t *testing.T) {
+	doc, _ := Parse(readFileContents("mocks/nytimes.com.html"))
+
+	out := &strings.Builder{}
+	if render_err := doc.RenderTo(out); render_err != nil {
+		t.Error(render_err.Error())
+	}
+	if out.String() != doc.Render() || !strings.HasPrefix(out.String(), "<!DOCTYPE html>\n<!--[if (gt IE 9)|!(IE)]> <!-->\n<html") {
+		t.Error("RenderTo should write what Render returns")
+	}
+	if render_err := doc.RenderTo(&failingWriter{limit: 10}); render_err == nil {
+		t.Error("a failed write should be returned")
+	}
+
+	text := &strings.Builder{}
+	if text_err := doc.TextTo(text); text_err != nil {
+		t.Error(text_err.Error())
+	}
+	if text.String() != doc.GetInnerText() || len(text.String()) == 0 {
+		t.Error("TextTo should write what GetInnerText returns")
+	}
+	if text_err := doc.TextTo(&failingWriter{limit: 10}); text_err == nil {
+		t.Error("a failed write should be returned")
+	}
+
+	p, _ := ParseFragment(`<p>one <b>two</b><![CDATA[three]]></p>`)
+	if p.GetInnerText() != "one twothree" {
+		t.Errorf("inner text is %q", p.GetInnerText())
+	}
+}
@@ -0,0 +1,704 @@
+package html
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//--------------------------------------------------------------------------------
+// COMPILED SELECTORS
+//--------------------------------------------------------------------------------
+
+// Selector is a parsed css selector group that can be matched against any number of documents.
+type Selector struct {
+	query string
+	group selectorGroup
+}
+
+// SelectorError is returned for queries that are not valid css selectors.
+type SelectorError struct {
+	Query   string
+	Column  int
+	Message string
+}
+
+func (se *SelectorError) Error() string {
+	return fmt.Sprintf("invalid selector `%s`: %s at column %d", se.Query, se.Message, se.Column)
+}
+
+// CompileSelector parses a css selector group, returning a `*SelectorError` if it is invalid.
+func CompileSelector(query string) (*Selector, error) {
+	query_runes := []rune(query)
+	cursor := 0
+	group, group_err := parseSelectorGroup(query_runes, &cursor)
+	if group_err != nil {
+		return nil, group_err
+	}
+	return &Selector{query: query, group: group}, nil
+}
+
+// MustCompileSelector is like CompileSelector but panics if the query is invalid.
+func MustCompileSelector(query string) *Selector {
+	selector, selector_err := CompileSelector(query)
+	if selector_err != nil {
+		panic(selector_err)
+	}
+	return selector
+}
+
+func (s *Selector) String() string {
+	return s.query
+}
+
+// Match returns if the element itself matches the selector.
+func (s *Selector) Match(e *Element) bool {
+	return s.group.matches(e)
+}
+
+// Filter returns the elements that match the selector.
+func (s *Selector) Filter(elements []*Element) []*Element {
+	results := []*Element{}
+	for _, element := range elements {
+		if s.group.matches(element) {
+			results = append(results, element)
+		}
+	}
+	return results
+}
+
+// Select returns every descendant of `e` that matches the selector, in document order.
+func (s *Selector) Select(e *Element) []*Element {
+	return s.Filter(e.Flatten())
+}
+
+//--------------------------------------------------------------------------------
+// TYPES: CSS SELECTORS
+//--------------------------------------------------------------------------------
+
+const (
+	COMBINATOR_DESCENDANT       = ' '
+	COMBINATOR_CHILD            = '>'
+	COMBINATOR_ADJACENT_SIBLING = '+'
+	COMBINATOR_GENERAL_SIBLING  = '~'
+)
+
+// compoundSelector is one run of simple selectors (`a.link[href]`). Complex selectors are
+// stored right to left, so `previous` is the compound to the left of `combinator`.
+type compoundSelector struct {
+	predicates []ElementPredicate
+	combinator rune
+	previous   *compoundSelector
+}
+
+type selectorGroup []*compoundSelector
+
+func (sg selectorGroup) matches(e *Element) bool {
+	for _, selector := range sg {
+		if selector.matches(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cs *compoundSelector) matches(e *Element) bool {
+	if !isElementNode(e) {
+		return false
+	}
+
+	for _, predicate := range cs.predicates {
+		if !predicate(e) {
+			return false
+		}
+	}
+
+	if cs.previous == nil {
+		return true
+	}
+
+	switch cs.combinator {
+	case COMBINATOR_DESCENDANT:
+		for ancestor := parentElementOf(e); ancestor != nil; ancestor = parentElementOf(ancestor) {
+			if cs.previous.matches(ancestor) {
+				return true
+			}
+		}
+	case COMBINATOR_CHILD:
+		parent := parentElementOf(e)
+		return parent != nil && cs.previous.matches(parent)
+	case COMBINATOR_ADJACENT_SIBLING:
+		siblings, index := elementSiblings(e)
+		return index > 0 && cs.previous.matches(siblings[index-1])
+	case COMBINATOR_GENERAL_SIBLING:
+		siblings, index := elementSiblings(e)
+		for x := index - 1; x >= 0; x-- {
+			if cs.previous.matches(siblings[x]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//--------------------------------------------------------------------------------
+// CSS SELECTOR PARSING
+//--------------------------------------------------------------------------------
+
+func parseSelectorGroup(query []rune, cursor *int) (selectorGroup, error) {
+	group := selectorGroup{}
+	for {
+		readWhitespace(query, cursor)
+		selector, selector_err := parseComplexSelector(query, cursor)
+		if selector_err != nil {
+			return nil, selector_err
+		}
+		group = append(group, selector)
+
+		readWhitespace(query, cursor)
+		if *cursor >= len(query) {
+			return group, nil
+		}
+		if query[*cursor] != ',' {
+			return nil, selectorError(query, *cursor, "unexpected character %q", query[*cursor])
+		}
+		*cursor++
+	}
+}
+
+func parseComplexSelector(query []rune, cursor *int) (*compoundSelector, error) {
+	selector, selector_err := parseCompoundSelector(query, cursor)
+	if selector_err != nil {
+		return nil, selector_err
+	}
+
+	for *cursor < len(query) {
+		whitespace, _ := readWhitespace(query, cursor)
+		if *cursor >= len(query) || query[*cursor] == ',' || query[*cursor] == ')' {
+			return selector, nil
+		}
+
+		combinator := rune(COMBINATOR_DESCENDANT)
+		switch query[*cursor] {
+		case COMBINATOR_CHILD, COMBINATOR_ADJACENT_SIBLING, COMBINATOR_GENERAL_SIBLING:
+			combinator = query[*cursor]
+			*cursor++
+			readWhitespace(query, cursor)
+		default:
+			if len(whitespace) == 0 {
+				return nil, selectorError(query, *cursor, "unexpected character %q", query[*cursor])
+			}
+		}
+
+		next, next_err := parseCompoundSelector(query, cursor)
+		if next_err != nil {
+			return nil, next_err
+		}
+		next.combinator = combinator
+		next.previous = selector
+		selector = next
+	}
+	return selector, nil
+}
+
+func parseCompoundSelector(query []rune, cursor *int) (*compoundSelector, error) {
+	selector := &compoundSelector{}
+	start := *cursor
+
+	if *cursor < len(query) && query[*cursor] == '*' {
+		*cursor++
+	} else if *cursor < len(query) && isIdentifierStart(query, *cursor) {
+		tag_name := strings.ToLower(readIdentifier(query, cursor))
+		selector.predicates = append(selector.predicates, func(e *Element) bool {
+			return strings.ToLower(e.ElementName) == tag_name
+		})
+	}
+
+	for *cursor < len(query) {
+		c := query[*cursor]
+		var predicate ElementPredicate
+		var predicate_err error
+
+		switch c {
+		case '#':
+			*cursor++
+			if !isIdentifierStart(query, *cursor) && !isIdentifierCharacter(query, *cursor) {
+				return nil, selectorError(query, *cursor, "expected an id after `#`")
+			}
+			id := readIdentifier(query, cursor)
+			predicate = func(e *Element) bool {
+				return e.Attributes["id"] == id
+			}
+		case '.':
+			*cursor++
+			if !isIdentifierStart(query, *cursor) {
+				return nil, selectorError(query, *cursor, "expected a class name after `.`")
+			}
+			class_name := readIdentifier(query, cursor)
+			predicate = func(e *Element) bool {
+				return e.HasClass(class_name)
+			}
+		case '[':
+			predicate, predicate_err = parseAttributeSelector(query, cursor)
+		case ':':
+			predicate, predicate_err = parsePseudoSelector(query, cursor)
+		case '*':
+			return nil, selectorError(query, *cursor, "the universal selector must come first")
+		default:
+			if *cursor == start {
+				return nil, selectorError(query, *cursor, "expected a selector, found %q", c)
+			}
+			return selector, nil
+		}
+
+		if predicate_err != nil {
+			return nil, predicate_err
+		}
+		selector.predicates = append(selector.predicates, predicate)
+	}
+
+	if *cursor == start {
+		return nil, selectorError(query, *cursor, "expected a selector")
+	}
+	return selector, nil
+}
+
+func parseAttributeSelector(query []rune, cursor *int) (ElementPredicate, error) {
+	*cursor++ // [
+	readWhitespace(query, cursor)
+	if !isIdentifierStart(query, *cursor) {
+		return nil, selectorError(query, *cursor, "expected an attribute name")
+	}
+	attr_name := strings.ToLower(readIdentifier(query, cursor))
+	readWhitespace(query, cursor)
+
+	if *cursor >= len(query) {
+		return nil, selectorError(query, *cursor, "unterminated attribute selector")
+	}
+
+	if query[*cursor] == ']' {
+		*cursor++
+		return func(e *Element) bool {
+			_, has_attr := selectorAttribute(e, attr_name)
+			return has_attr
+		}, nil
+	}
+
+	operator := EMPTY
+	if query[*cursor] == '=' {
+		operator = "="
+		*cursor++
+	} else if strings.ContainsRune("~|^$*", query[*cursor]) && *cursor+1 < len(query) && query[*cursor+1] == '=' {
+		operator = string(query[*cursor : *cursor+2])
+		*cursor += 2
+	} else {
+		return nil, selectorError(query, *cursor, "unexpected character %q in attribute selector", query[*cursor])
+	}
+
+	readWhitespace(query, cursor)
+	var value string
+	if *cursor < len(query) && (query[*cursor] == '"' || query[*cursor] == '\'') {
+		string_value, string_err := readSelectorString(query, cursor)
+		if string_err != nil {
+			return nil, string_err
+		}
+		value = string_value
+	} else if isIdentifierStart(query, *cursor) {
+		value = readIdentifier(query, cursor)
+	} else {
+		return nil, selectorError(query, *cursor, "expected an attribute value")
+	}
+
+	readWhitespace(query, cursor)
+	if *cursor >= len(query) || query[*cursor] != ']' {
+		return nil, selectorError(query, *cursor, "expected `]`")
+	}
+	*cursor++
+
+	return func(e *Element) bool {
+		attr_value, has_attr := selectorAttribute(e, attr_name)
+		if !has_attr {
+			return false
+		}
+		return matchAttributeOperator(operator, attr_value, value)
+	}, nil
+}
+
+// selectorAttribute looks up an attribute by its lowercased name, which for svg and mathml elements
+// also matches the camel cased names like `viewBox`.
+func selectorAttribute(e *Element, name string) (string, bool) {
+	if value, has_attr := e.Attributes[name]; has_attr || !isForeignNamespace(e.Namespace) {
+		return value, has_attr
+	}
+	for attr_name, value := range e.Attributes {
+		if strings.ToLower(attr_name) == name {
+			return value, true
+		}
+	}
+	return EMPTY, false
+}
+
+func matchAttributeOperator(operator, actual, expected string) bool {
+	switch operator {
+	case "=":
+		return actual == expected
+	case "~=":
+		if len(expected) == 0 || strings.IndexFunc(expected, isWhitespace) >= 0 {
+			return false
+		}
+		return sliceContains(strings.FieldsFunc(actual, isWhitespace), expected)
+	case "|=":
+		return actual == expected || strings.HasPrefix(actual, expected+"-")
+	case "^=":
+		return len(expected) > 0 && strings.HasPrefix(actual, expected)
+	case "$=":
+		return len(expected) > 0 && strings.HasSuffix(actual, expected)
+	case "*=":
+		return len(expected) > 0 && strings.Contains(actual, expected)
+	}
+	return false
+}
+
+func parsePseudoSelector(query []rune, cursor *int) (ElementPredicate, error) {
+	*cursor++                                          // :
+	if *cursor < len(query) && query[*cursor] == ':' { //pseudo-elements never match a node in the tree.
+		*cursor++
+		if !isIdentifierStart(query, *cursor) {
+			return nil, selectorError(query, *cursor, "expected a pseudo-element name")
+		}
+		readIdentifier(query, cursor)
+		return func(e *Element) bool { return false }, nil
+	}
+
+	name_start := *cursor
+	if !isIdentifierStart(query, *cursor) {
+		return nil, selectorError(query, *cursor, "expected a pseudo-class name")
+	}
+	name := strings.ToLower(readIdentifier(query, cursor))
+
+	if *cursor < len(query) && query[*cursor] == '(' {
+		*cursor++
+		readWhitespace(query, cursor)
+		predicate, predicate_err := parseFunctionalPseudoClass(name, name_start, query, cursor)
+		if predicate_err != nil {
+			return nil, predicate_err
+		}
+		readWhitespace(query, cursor)
+		if *cursor >= len(query) || query[*cursor] != ')' {
+			return nil, selectorError(query, *cursor, "expected `)`")
+		}
+		*cursor++
+		return predicate, nil
+	}
+
+	switch name {
+	case "root":
+		return func(e *Element) bool { return parentElementOf(e) == nil }, nil
+	case "first-child":
+		return nthChildPredicate(0, 1, false, false), nil
+	case "last-child":
+		return nthChildPredicate(0, 1, true, false), nil
+	case "only-child":
+		return func(e *Element) bool {
+			siblings, _ := elementSiblings(e)
+			return len(siblings) == 1
+		}, nil
+	case "first-of-type":
+		return nthChildPredicate(0, 1, false, true), nil
+	case "last-of-type":
+		return nthChildPredicate(0, 1, true, true), nil
+	case "only-of-type":
+		return func(e *Element) bool {
+			siblings, _ := elementSiblingsOfType(e)
+			return len(siblings) == 1
+		}, nil
+	case "empty":
+		return func(e *Element) bool {
+			for child := e.FirstChild; child != nil; child = child.NextSibling {
+				if !child.IsComment && !child.IsProcessingInstruction {
+					return false
+				}
+			}
+			return true
+		}, nil
+	case "link", "any-link":
+		return func(e *Element) bool {
+			_, has_href := e.Attributes["href"]
+			return has_href && (e.ElementName == ELEMENT_A || e.ElementName == ELEMENT_AREA || e.ElementName == ELEMENT_LINK)
+		}, nil
+	case "checked":
+		return func(e *Element) bool {
+			_, is_checked := e.Attributes["checked"]
+			_, is_selected := e.Attributes["selected"]
+			return (e.ElementName == ELEMENT_INPUT && is_checked) || (e.ElementName == ELEMENT_OPTION && is_selected)
+		}, nil
+	case "disabled":
+		return func(e *Element) bool {
+			_, is_disabled := e.Attributes["disabled"]
+			return is_disabled && isFormElement(e)
+		}, nil
+	case "enabled":
+		return func(e *Element) bool {
+			_, is_disabled := e.Attributes["disabled"]
+			return !is_disabled && isFormElement(e)
+		}, nil
+	case "visited", "hover", "active", "focus", "target":
+		return func(e *Element) bool { return false }, nil //user action states don't exist in a parsed document.
+	}
+
+	return nil, selectorError(query, name_start, "unknown pseudo-class `:%s`", name)
+}
+
+func parseFunctionalPseudoClass(name string, nameStart int, query []rune, cursor *int) (ElementPredicate, error) {
+	switch name {
+	case "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+		a, b, nth_err := parseNth(query, cursor)
+		if nth_err != nil {
+			return nil, nth_err
+		}
+		from_end := strings.HasPrefix(name, "nth-last-")
+		of_type := strings.HasSuffix(name, "-of-type")
+		return nthChildPredicate(a, b, from_end, of_type), nil
+	case "not":
+		negated, negated_err := parseCompoundSelector(query, cursor)
+		if negated_err != nil {
+			return nil, negated_err
+		}
+		return func(e *Element) bool {
+			return !negated.matches(e)
+		}, nil
+	case "lang":
+		if !isIdentifierStart(query, *cursor) {
+			return nil, selectorError(query, *cursor, "expected a language code")
+		}
+		lang := strings.ToLower(readIdentifier(query, cursor))
+		return func(e *Element) bool {
+			for node := e; node != nil && !node.IsRoot; node = node.Parent {
+				if node_lang, has_lang := node.Attributes["lang"]; has_lang {
+					return matchAttributeOperator("|=", strings.ToLower(node_lang), lang)
+				}
+			}
+			return false
+		}, nil
+	}
+	return nil, selectorError(query, nameStart, "unknown pseudo-class `:%s()`", name)
+}
+
+// parseNth reads the `an+b` micro-syntax used by the :nth-* pseudo-classes.
+func parseNth(query []rune, cursor *int) (a int, b int, err error) {
+	start := *cursor
+	for *cursor < len(query) && query[*cursor] != ')' {
+		*cursor++
+	}
+	expression := strings.ToLower(strings.Join(strings.Fields(string(query[start:*cursor])), EMPTY))
+
+	switch expression {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	case EMPTY:
+		return 0, 0, selectorError(query, start, "expected an `an+b` expression")
+	}
+
+	n_index := strings.IndexRune(expression, 'n')
+	if n_index < 0 {
+		b, err = strconv.Atoi(expression)
+		if err != nil {
+			return 0, 0, selectorError(query, start, "invalid `an+b` expression %q", expression)
+		}
+		return 0, b, nil
+	}
+
+	switch coefficient := expression[:n_index]; coefficient {
+	case EMPTY, "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		a, err = strconv.Atoi(coefficient)
+		if err != nil {
+			return 0, 0, selectorError(query, start, "invalid `an+b` expression %q", expression)
+		}
+	}
+
+	if offset := expression[n_index+1:]; len(offset) > 0 {
+		if offset[0] != '+' && offset[0] != '-' {
+			return 0, 0, selectorError(query, start, "invalid `an+b` expression %q", expression)
+		}
+		b, err = strconv.Atoi(offset)
+		if err != nil {
+			return 0, 0, selectorError(query, start, "invalid `an+b` expression %q", expression)
+		}
+	}
+	return a, b, nil
+}
+
+func nthChildPredicate(a, b int, fromEnd bool, ofType bool) ElementPredicate {
+	return func(e *Element) bool {
+		var siblings []*Element
+		var index int
+		if ofType {
+			siblings, index = elementSiblingsOfType(e)
+		} else {
+			siblings, index = elementSiblings(e)
+		}
+
+		position := index + 1
+		if fromEnd {
+			position = len(siblings) - index
+		}
+
+		if a == 0 {
+			return position == b
+		}
+		n := position - b
+		return n%a == 0 && n/a >= 0
+	}
+}
+
+func readSelectorString(query []rune, cursor *int) (string, error) {
+	start := *cursor
+	quote_character := query[*cursor]
+	*cursor++
+
+	value := []rune{}
+	for *cursor < len(query) {
+		c := query[*cursor]
+		if c == quote_character {
+			*cursor++
+			return string(value), nil
+		} else if c == '\\' {
+			value = append(value, readSelectorEscape(query, cursor)...)
+		} else {
+			value = append(value, c)
+			*cursor++
+		}
+	}
+	return EMPTY, selectorError(query, start, "unterminated string")
+}
+
+func readIdentifier(query []rune, cursor *int) string {
+	value := []rune{}
+	for *cursor < len(query) && isIdentifierCharacter(query, *cursor) {
+		if query[*cursor] == '\\' {
+			value = append(value, readSelectorEscape(query, cursor)...)
+		} else {
+			value = append(value, query[*cursor])
+			*cursor++
+		}
+	}
+	return string(value)
+}
+
+// readSelectorEscape reads a css escape sequence, either `\` followed by up to six hex digits
+// and an optional space, or `\` followed by any other literal character.
+func readSelectorEscape(query []rune, cursor *int) []rune {
+	*cursor++ // \
+	if *cursor >= len(query) {
+		return []rune{}
+	}
+
+	start := *cursor
+	for *cursor < len(query) && *cursor-start < 6 && isHexDigit(query[*cursor]) {
+		*cursor++
+	}
+	if *cursor == start {
+		*cursor++
+		return query[start:*cursor]
+	}
+
+	code_point, _ := strconv.ParseInt(string(query[start:*cursor]), 16, 32)
+	if *cursor < len(query) && isWhitespace(query[*cursor]) {
+		*cursor++
+	}
+	if code_point == 0 || code_point > 0x10FFFF {
+		return []rune{'�'}
+	}
+	return []rune{rune(code_point)}
+}
+
+func isIdentifierStart(query []rune, index int) bool {
+	if index >= len(query) {
+		return false
+	}
+	c := query[index]
+	if c == '-' {
+		return index+1 < len(query) && (query[index+1] == '-' || isIdentifierStart(query, index+1))
+	}
+	return c == '_' || c == '\\' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierCharacter(query []rune, index int) bool {
+	if index >= len(query) {
+		return false
+	}
+	c := query[index]
+	return c == '-' || c == '_' || c == '\\' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isHexDigit(c rune) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func selectorError(query []rune, cursor int, format string, args ...interface{}) error {
+	return &SelectorError{Query: string(query), Column: cursor + 1, Message: fmt.Sprintf(format, args...)}
+}
+
+//--------------------------------------------------------------------------------
+// UTILITY: TREE NAVIGATION
+//--------------------------------------------------------------------------------
+
+func isElementNode(e *Element) bool {
+	return e != nil && !(e.IsRoot || e.IsText || e.IsComment || e.IsDoctype || e.IsCData || e.IsProcessingInstruction)
+}
+
+func parentElementOf(e *Element) *Element {
+	if e.Parent == nil || e.Parent.IsRoot {
+		return nil
+	}
+	return e.Parent
+}
+
+// elementSiblings returns the element children of `e`'s parent (including `e`) and the index of `e` among them.
+func elementSiblings(e *Element) ([]*Element, int) {
+	first := e
+	for first.PrevSibling != nil {
+		first = first.PrevSibling
+	}
+
+	siblings := []*Element{}
+	index := 0
+	for sibling := first; sibling != nil; sibling = sibling.NextSibling {
+		if sibling == e {
+			index = len(siblings)
+			siblings = append(siblings, e)
+		} else if isElementNode(sibling) {
+			siblings = append(siblings, sibling)
+		}
+	}
+	return siblings, index
+}
+
+func elementSiblingsOfType(e *Element) ([]*Element, int) {
+	all_siblings, all_index := elementSiblings(e)
+	siblings := []*Element{}
+	index := 0
+	for x, sibling := range all_siblings {
+		if x == all_index {
+			index = len(siblings)
+		}
+		if sibling.ElementName == e.ElementName {
+			siblings = append(siblings, sibling)
+		}
+	}
+	return siblings, index
+}
+
+func isFormElement(e *Element) bool {
+	switch e.ElementName {
+	case ELEMENT_BUTTON, ELEMENT_INPUT, ELEMENT_SELECT, ELEMENT_OPTION, ELEMENT_OPTGROUP, ELEMENT_TEXTAREA, ELEMENT_FIELDSET, ELEMENT_KEYGEN:
+		return true
+	}
+	return false
+}
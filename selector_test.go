@@ -0,0 +1,216 @@
+package html
+
+import (
+	"testing"
+)
+
+const SELECTOR_DOC = `
+<html lang="en-US">
+	<body>
+		<div id="main" class="container">
+			<ul class="menu">
+				<li class="item first"><a href="/home" hreflang="en-US">Home</a></li>
+				<li class="item"><a href="http://example.com/about.pdf" target="_blank">About</a></li>
+				<li class="item"><a name="anchor">Anchor</a></li>
+				<li class="item last"><span>Contact</span></li>
+			</ul>
+			<p>First</p>
+			<h2>Heading</h2>
+			<p>Second</p>
+			<p class="empty"></p>
+			<input type="checkbox" checked>
+			<input type="text" disabled>
+		</div>
+		<div class="footer"><p lang="fr">Fin</p></div>
+	</body>
+</html>`
+
+func TestQuerySelectorAll(t *testing.T) {
+	doc, parse_err := Parse(SELECTOR_DOC)
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+
+	test_cases := map[string]int{
+		"a":                         3,
+		"*":                         21,
+		"#main":                     1,
+		"div#main.container":        1,
+		".item":                     4,
+		".item.first":               1,
+		"ul li a":                   3,
+		"ul > a":                    0,
+		"ul > li > a":               3,
+		"div > p":                   4,
+		"h2 + p":                    1,
+		"h2 ~ p":                    2,
+		"ul ~ p":                    3,
+		"p, h2":                     5,
+		"a[href]":                   2,
+		"a[target=_blank]":          1,
+		`a[href="/home"]`:           1,
+		"li[class~=last]":           1,
+		"a[hreflang|=en]":           1,
+		"a[href^=http]":             1,
+		"a[href$='.pdf']":           1,
+		"a[href*=example]":          1,
+		"a[href^='']":               0,
+		"li:first-child":            1,
+		"li:last-child":             1,
+		"li:nth-child(2n)":          2,
+		"li:nth-child(odd)":         2,
+		"li:nth-child(-n+3)":        3,
+		"li:nth-last-child(1)":      1,
+		"p:first-of-type":           2,
+		"p:last-of-type":            2,
+		"p:nth-of-type(2)":          1,
+		"h2:only-of-type":           1,
+		"a:only-child":              3,
+		"p:empty":                   1,
+		"div:not(.footer)":          1,
+		"li:not(.first):not(.last)": 2,
+		":root":                     1,
+		"html:root > body":          1,
+		"input:checked":             1,
+		"input:disabled":            1,
+		"input:enabled":             1,
+		"a:link":                    2,
+		"p:lang(fr)":                1,
+		"li:lang(en)":               4,
+		"p::before":                 0,
+	}
+
+	for query, expected := range test_cases {
+		results, query_err := doc.QuerySelectorAll(query)
+		if query_err != nil {
+			t.Errorf("%s: %s", query, query_err.Error())
+			t.FailNow()
+		}
+		if len(results) != expected {
+			t.Errorf("QuerySelectorAll(%q) count is %d, expected %d", query, len(results), expected)
+		}
+	}
+}
+
+func TestQuerySelector(t *testing.T) {
+	doc, _ := Parse(SELECTOR_DOC)
+
+	first, query_err := doc.QuerySelector("li.item a")
+	if query_err != nil {
+		t.Error(query_err.Error())
+		t.FailNow()
+	}
+	if first == nil || first.Attributes["href"] != "/home" {
+		t.Error("QuerySelector returned the wrong element")
+		t.FailNow()
+	}
+
+	missing, query_err := doc.QuerySelector("table")
+	if query_err != nil {
+		t.Error(query_err.Error())
+		t.FailNow()
+	}
+	if missing != nil {
+		t.Error("QuerySelector should have returned nil")
+		t.FailNow()
+	}
+
+	menu, _ := doc.QuerySelector("ul.menu")
+	links, _ := menu.QuerySelectorAll("a")
+	if len(links) != 3 {
+		t.Errorf("scoped QuerySelectorAll count is %d, expected 3", len(links))
+		t.FailNow()
+	}
+}
+
+func TestQuerySelectorInvalid(t *testing.T) {
+	doc, _ := Parse(SNIPPET)
+
+	invalid := []string{
+		"",
+		"div >",
+		"div,",
+		"#",
+		".",
+		"a[href",
+		"a[href=]",
+		"a[href='x]",
+		"p:unknown",
+		"li:nth-child(x)",
+		"div !",
+		"a*",
+	}
+
+	for _, query := range invalid {
+		if _, query_err := doc.QuerySelectorAll(query); query_err == nil {
+			t.Errorf("QuerySelectorAll(%q) should have errored", query)
+		}
+	}
+}
+
+func TestCompileSelector(t *testing.T) {
+	doc, _ := Parse(SELECTOR_DOC)
+
+	selector, compile_err := CompileSelector("ul.menu > li:not(.last) a[href]")
+	if compile_err != nil {
+		t.Error(compile_err.Error())
+		t.FailNow()
+	}
+
+	selected := selector.Select(doc)
+	if len(selected) != 2 {
+		t.Errorf("Select() count is %d, expected 2", len(selected))
+		t.FailNow()
+	}
+
+	anchors := doc.GetElementsByTagName(ELEMENT_A)
+	if len(selector.Filter(anchors)) != 2 {
+		t.Error("Filter() should keep the two linked anchors")
+		t.FailNow()
+	}
+
+	if !selector.Match(anchors[0]) {
+		t.Error("Match() should match the first anchor")
+		t.FailNow()
+	}
+	if selector.Match(anchors[2]) {
+		t.Error("Match() should not match an anchor without an href")
+		t.FailNow()
+	}
+
+	items := MustCompileSelector("li + li").Filter(doc.GetElementsByTagName(ELEMENT_LI))
+	if len(items) != 3 {
+		t.Errorf("sibling combinator Filter() count is %d, expected 3", len(items))
+		t.FailNow()
+	}
+}
+
+func TestCompileSelectorError(t *testing.T) {
+	test_cases := map[string]int{
+		"div >":              6,
+		"a[href=]":           8,
+		"div !":              5,
+		"p:unknown":          3,
+		"ul li:nth-child(x)": 17,
+	}
+
+	for query, column := range test_cases {
+		_, compile_err := CompileSelector(query)
+		selector_err, is_selector_err := compile_err.(*SelectorError)
+		if !is_selector_err {
+			t.Errorf("CompileSelector(%q) should return a *SelectorError", query)
+			t.FailNow()
+		}
+		if selector_err.Column != column {
+			t.Errorf("CompileSelector(%q) error column is %d, expected %d", query, selector_err.Column, column)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("MustCompileSelector should panic on an invalid selector")
+		}
+	}()
+	MustCompileSelector("div >")
+}
@@ -0,0 +1,150 @@
+package html
+
+import (
+	"io"
+	"strings"
+)
+
+//--------------------------------------------------------------------------------
+// SERIALIZATION
+//--------------------------------------------------------------------------------
+
+// These follow the HTML5 serialization algorithm: nothing is indented or trimmed, text and attribute
+// values are escaped, void elements get no end tag and the contents of script / style are written as is.
+// Self-closed svg and mathml elements stay self-closed, and doctypes keep their public and system ids.
+// A `<pre>`, `<listing>` or `<textarea>` whose text starts with a newline gets another one in front of it, since the
+// parser drops the first. `<plaintext>` gets no end tag, since nothing ends it when it's parsed again, and attributes whose names
+// can't be written in a tag (set through SetAttr or the Attributes map) are left out.
+
+var (
+	TEXT_ESCAPER      = strings.NewReplacer("&", "&amp;", "\u00a0", "&nbsp;", "<", "&lt;", ">", "&gt;")
+	ATTRIBUTE_ESCAPER = strings.NewReplacer("&", "&amp;", "\u00a0", "&nbsp;", "\"", "&quot;")
+
+	// elements whose text is written without escaping.
+	RAW_TEXT_SERIALIZED_ELEMENTS = map[string]bool{
+		ELEMENT_STYLE: true, ELEMENT_SCRIPT: true, "xmp": true, ELEMENT_IFRAME: true, "noembed": true,
+		"noframes": true, "plaintext": true, ELEMENT_NOSCRIPT: true,
+	}
+)
+
+// InnerHTML returns the element's contents as html, written from the tree as it is now.
+func (e Element) InnerHTML() string {
+	out := &strings.Builder{}
+	(&htmlWriter{w: out}).writeChildren(&e)
+	return out.String()
+}
+
+// OuterHTML returns the element and its contents as html; for the root that's the whole document.
+func (e Element) OuterHTML() string {
+	out := &strings.Builder{}
+	e.WriteTo(out)
+	return out.String()
+}
+
+// WriteTo writes the element as html the way OuterHTML does, returning the number of bytes written.
+func (e Element) WriteTo(w io.Writer) (int64, error) {
+	hw := &htmlWriter{w: w}
+	hw.writeNode(&e)
+	return hw.n, hw.err
+}
+
+// htmlWriter keeps the count of bytes written and the first error, after which it writes nothing.
+type htmlWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (hw *htmlWriter) WriteString(s string) {
+	if hw.err != nil || len(s) == 0 {
+		return
+	}
+	written, write_err := io.WriteString(hw.w, s)
+	hw.n += int64(written)
+	hw.err = write_err
+}
+
+func (hw *htmlWriter) writeNode(e *Element) {
+	switch {
+	case e.IsRoot:
+		hw.writeChildren(e)
+	case e.IsText:
+		if isRawTextParent(e.Parent) {
+			hw.WriteString(e.Text)
+		} else {
+			hw.WriteString(TEXT_ESCAPER.Replace(e.Text))
+		}
+	case e.IsComment:
+		hw.WriteString("<!--" + e.Text + "-->")
+	case e.IsDoctype:
+		if e.Doctype != nil {
+			hw.WriteString(e.Doctype.String())
+		} else {
+			hw.WriteString("<!DOCTYPE html>")
+		}
+	case e.IsCData:
+		hw.WriteString("<![CDATA[" + e.Text + "]]>")
+	case e.IsProcessingInstruction:
+		hw.WriteString("<?" + e.Text + "?>")
+	default:
+		hw.writeElement(e)
+	}
+}
+
+func (hw *htmlWriter) writeElement(e *Element) {
+	hw.WriteString("<" + e.ElementName)
+	for _, attr := range serializedAttributes(e) {
+		hw.WriteString(" " + attr.Name + "=\"" + ATTRIBUTE_ESCAPER.Replace(attr.Value) + "\"")
+	}
+
+	if isForeignNamespace(e.Namespace) && e.FirstChild == nil && e.IsVoid {
+		hw.WriteString("/>")
+		return
+	}
+	hw.WriteString(">")
+	if !isForeignNamespace(e.Namespace) && isKnownVoidElement(e.ElementName) {
+		return
+	}
+	hw.WriteString(leadingNewline(e))
+	hw.writeChildren(e)
+	hw.WriteString(endTag(e))
+}
+
+func (hw *htmlWriter) writeChildren(e *Element) {
+	for child := e.FirstChild; child != nil && hw.err == nil; child = child.NextSibling {
+		hw.writeNode(child)
+	}
+}
+
+func isRawTextParent(parent *Element) bool {
+	return parent != nil && !isForeignNamespace(parent.Namespace) && RAW_TEXT_SERIALIZED_ELEMENTS[parent.ElementName]
+}
+
+// serializedAttributes returns the element's attributes that can be written in a tag; a name with whitespace,
+// a quote, `>`, `/` or `=` in it would break the markup, so it's skipped.
+func serializedAttributes(e *Element) []Attribute {
+	attributes := []Attribute{}
+	for _, attr := range e.AttributeList() {
+		if len(attr.Name) > 0 && !strings.ContainsAny(attr.Name, " \t\n\f\r\"'>/=") {
+			attributes = append(attributes, attr)
+		}
+	}
+	return attributes
+}
+
+// leadingNewline returns the newline to write after the start tag of an element that drops one, when its text
+// starts with a newline that would otherwise be lost.
+func leadingNewline(e *Element) string {
+	if !isForeignNamespace(e.Namespace) && LEADING_NEWLINE_ELEMENTS[e.ElementName] && e.FirstChild != nil && e.FirstChild.IsText && strings.HasPrefix(e.FirstChild.Text, "\n") {
+		return "\n"
+	}
+	return EMPTY
+}
+
+// endTag returns the element's end tag, which is empty for `<plaintext>` as the parser never ends one.
+func endTag(e *Element) string {
+	if e.ElementName == "plaintext" && !isForeignNamespace(e.Namespace) {
+		return EMPTY
+	}
+	return "</" + e.ElementName + ">"
+}
@@ -0,0 +1,151 @@
+package html
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOuterHTML(t *testing.T) {
+	testCases := map[string]string{
+		`<p class="a">  one <b>two</b> three  </p>`:                `<p class="a">  one <b>two</b> three  </p>`,
+		`<p title='say "hi"' data-x=a&amp;b>1 &lt; 2 &amp;&nbsp;3`: `<p title="say &quot;hi&quot;" data-x="a&amp;b">1 &lt; 2 &amp;&nbsp;3</p>`,
+		`<div><br/><img src=a.png><input disabled></div>`:          `<div><br><img src="a.png"><input disabled=""></div>`,
+		`<ul><li>a<li>b</ul>`:                                      `<ul><li>a</li><li>b</li></ul>`,
+		`<script>if (a < b && c) { d("</p>"); }</script>`:          `<script>if (a < b && c) { d("</p>"); }</script>`,
+		`<textarea>a &lt;b&gt;</textarea>`:                         `<textarea>a &lt;b&gt;</textarea>`,
+		`<svg viewBox="0 0 1 1"><path d="M0 0"/><g></g></svg>`:     `<svg viewBox="0 0 1 1"><path d="M0 0"/><g></g></svg>`,
+		`<!-- note --><?xml version="1.0"?><p>a</p>`:               `<!-- note --><?xml version="1.0"?><p>a</p>`,
+	}
+
+	for input, expected := range testCases {
+		doc, parse_err := ParseFragment(input)
+		if parse_err != nil {
+			t.Errorf("%s: %s", input, parse_err.Error())
+			continue
+		}
+		if actual := doc.OuterHTML(); actual != expected {
+			t.Errorf("%s serialized as %s, expected %s", input, actual, expected)
+		}
+	}
+
+	doc, _ := Parse(`<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01//EN"><title>a&amp;b</title><p>c`)
+	if actual := doc.OuterHTML(); actual != `<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01//EN"><html><head><title>a&amp;b</title></head><body><p>c</p></body></html>` {
+		t.Errorf("document serialized as %s", actual)
+	}
+	if p, _ := doc.QuerySelector("p"); p.OuterHTML() != "<p>c</p>" || p.Children()[0].OuterHTML() != "c" {
+		t.Error("a single element should serialize on its own")
+	}
+}
+
+func TestInnerHTML(t *testing.T) {
+	doc, _ := Parse(`<div id="main"><p>one</p></div>`)
+	main := doc.GetElementById("main")
+	if main.SourceHTML != "<p>one</p>" || main.InnerHTML() != "<p>one</p>" {
+		t.Errorf("inner html is %s, source %s", main.InnerHTML(), main.SourceHTML)
+	}
+
+	p := main.Children()[0]
+	p.AddClass("lead")
+	p.SetId("first")
+	main.AddChild(&Element{ElementName: ELEMENT_HR, IsVoid: true})
+	if actual := main.InnerHTML(); actual != `<p class="lead" id="first">one</p><hr>` {
+		t.Errorf("inner html after changes is %s", actual)
+	}
+	if actual := main.OuterHTML(); actual != `<div id="main"><p class="lead" id="first">one</p><hr></div>` {
+		t.Errorf("outer html after changes is %s", actual)
+	}
+	if main.SourceHTML != "<p>one</p>" {
+		t.Error("the source should be left as it was parsed")
+	}
+	if p.Children()[0].InnerHTML() != EMPTY || p.Children()[0].OuterHTML() != "one" {
+		t.Error("text has no inner html")
+	}
+}
+
+func TestOuterHTMLUnwritable(t *testing.T) {
+	doc, _ := ParseFragment("<div></div><plaintext>a")
+	div := doc.FirstChild
+	div.SetAttr("id", "a")
+	div.SetAttr(`x"y`, "1")
+	div.SetAttr("a b", "2")
+	div.Attributes["c=d"] = "3"
+	div.Attributes["/"] = "4"
+	if actual := doc.OuterHTML(); actual != `<div id="a"></div><plaintext>a` {
+		t.Errorf("serialized as %s", actual)
+	}
+	if actual := doc.Minify(MinifyOptions{}); actual != `<div id=a></div><plaintext>a` {
+		t.Errorf("minified as %s", actual)
+	}
+}
+
+func TestOuterHTMLRoundTrip(t *testing.T) {
+	//html already written the way the serializer writes it comes back out unchanged, whitespace and all.
+	sources := []string{
+		"<!DOCTYPE html>\n<html><head>\n  <title>a</title>\n</head>\n<body>\n  <p><span>a</span> <span>b</span></p>\n</body></html>",
+		"<div>\n\t<pre>\n\n  one\n    two  \n</pre>\n\t<textarea>  three\n</textarea>\n</div>",
+		"<ul>\n  <li>one</li>\n  <!-- two -->\n  <li>three</li>\n</ul>  ",
+		"<p>a</p><plaintext>b</plaintext>",
+	}
+	for _, source := range sources {
+		doc, parse_err := ParseFragment(source)
+		if parse_err != nil {
+			t.Errorf("%q: %s", source, parse_err.Error())
+			continue
+		}
+		if actual := doc.OuterHTML(); actual != source {
+			t.Errorf("%q serialized as %q", source, actual)
+		}
+	}
+
+	doc, _ := ParseFragment("<p><span>a</span> <span>b</span></p>")
+	if text := doc.GetInnerText(); text != "a b" {
+		t.Errorf("the space between elements should be kept, got %q", text)
+	}
+
+	for _, mock_file := range []string{"blendlabs.com.html", "news.ycombinator.com.html", "nytimes.com.html"} {
+		doc, _ := Parse(readFileContents("mocks/" + mock_file))
+		serialized := doc.OuterHTML()
+
+		reparsed, parse_err := Parse(serialized)
+		if parse_err != nil {
+			t.Errorf("%s: %s", mock_file, parse_err.Error())
+			continue
+		}
+		if reparsed.OuterHTML() != serialized {
+			t.Errorf("%s changed when it was parsed again", mock_file)
+		}
+		if outline(reparsed) != outline(doc) {
+			t.Errorf("%s parsed into a different tree", mock_file)
+		}
+	}
+}
+
+type failingWriter struct {
+	limit int
+}
+
+func (fw *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > fw.limit {
+		written := fw.limit
+		fw.limit = 0
+		return written, errors.New("full")
+	}
+	fw.limit -= len(p)
+	return len(p), nil
+}
+
+func TestWriteTo(t *testing.T) {
+	doc, _ := ParseFragment("<div><p>one</p><p>two</p></div>")
+
+	out := &strings.Builder{}
+	written, write_err := doc.WriteTo(out)
+	if write_err != nil || written != int64(out.Len()) || out.String() != "<div><p>one</p><p>two</p></div>" {
+		t.Errorf("wrote %d bytes of %q, %v", written, out.String(), write_err)
+	}
+
+	written, write_err = doc.WriteTo(&failingWriter{limit: 10})
+	if write_err == nil || written != 10 {
+		t.Errorf("a failed write should stop, wrote %d bytes with %v", written, write_err)
+	}
+}
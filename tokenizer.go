@@ -0,0 +1,448 @@
+package html
+
+import (
+	"io"
+	"strings"
+)
+
+//--------------------------------------------------------------------------------
+// TYPES: TOKENS
+//--------------------------------------------------------------------------------
+
+type TokenType int
+
+const (
+	TOKEN_TEXT TokenType = iota
+	TOKEN_START_TAG
+	TOKEN_END_TAG
+	TOKEN_SELF_CLOSING_TAG
+	TOKEN_COMMENT
+	TOKEN_DOCTYPE
+	TOKEN_CDATA
+	TOKEN_PROCESSING_INSTRUCTION
+)
+
+func (tt TokenType) String() string {
+	switch tt {
+	case TOKEN_TEXT:
+		return "Text"
+	case TOKEN_START_TAG:
+		return "StartTag"
+	case TOKEN_END_TAG:
+		return "EndTag"
+	case TOKEN_SELF_CLOSING_TAG:
+		return "SelfClosingTag"
+	case TOKEN_COMMENT:
+		return "Comment"
+	case TOKEN_DOCTYPE:
+		return "Doctype"
+	case TOKEN_CDATA:
+		return "CDATA"
+	case TOKEN_PROCESSING_INSTRUCTION:
+		return "ProcessingInstruction"
+	}
+	return "Unknown"
+}
+
+// Attribute is a name and value from a tag. `Value` has its character references decoded, and `Raw` is
+// the value as it appeared in the source. `Quote` is the quote character the value was wrapped in, or 0
+// if it wasn't quoted, and `Namespace` is only set for the xlink, xml and xmlns attributes of svg and mathml.
+type Attribute struct {
+	Name      string
+	Value     string
+	Raw       string
+	Namespace string
+	Quote     rune
+	Position  Position
+}
+
+// Token is a single lexical piece of a document. `Name` is the lowercased tag name, `Data` holds the
+// contents of text, comment and doctype tokens, and `Start` / `End` are where the token sits in the source.
+// Text has its character references decoded in `Data`, with `Raw` holding the text as it was in the source.
+type Token struct {
+	Type       TokenType
+	Name       string
+	Attributes []Attribute
+	Data       string
+	Raw        string
+	Start      Location
+	End        Location
+}
+
+// Attr returns the value of the first attribute with the given name.
+func (t Token) Attr(name string) (string, bool) {
+	name_lower := strings.ToLower(name)
+	for _, attr := range t.Attributes {
+		if attr.Name == name_lower {
+			return attr.Value, true
+		}
+	}
+	return EMPTY, false
+}
+
+//--------------------------------------------------------------------------------
+// TYPES: TOKENIZER
+//--------------------------------------------------------------------------------
+
+// Tokenizer splits a document read from an `io.Reader` into tokens without building an element tree.
+type Tokenizer struct {
+	scanner *runeScanner
+	pending []Token
+
+	rawText string
+}
+
+var (
+	// elements whose contents are read as text up to their end tag.
+	RAW_TEXT_ELEMENTS = map[string]bool{
+		ELEMENT_STYLE: true, "xmp": true, ELEMENT_IFRAME: true, "noembed": true, "noframes": true,
+		ELEMENT_NOSCRIPT: true, "plaintext": true,
+	}
+	// elements read like raw text but with character references decoded.
+	RCDATA_ELEMENTS = map[string]bool{
+		ELEMENT_TEXTAREA: true, ELEMENT_TITLE: true,
+	}
+)
+
+func NewTokenizer(r io.Reader) *Tokenizer {
+	return &Tokenizer{scanner: newRuneScanner(r)}
+}
+
+// Next returns the next token, or `io.EOF` once the input is exhausted.
+func (t *Tokenizer) Next() (Token, error) {
+	if len(t.pending) > 0 {
+		token := t.pending[0]
+		t.pending = t.pending[1:]
+		return token, nil
+	}
+
+	t.scanner.Discard()
+	start := t.scanner.Location()
+	mark := t.scanner.Mark()
+
+	if t.rawText != EMPTY {
+		element_name := t.rawText
+		t.rawText = EMPTY
+		return t.readRawText(start, element_name)
+	}
+
+	if t.scanner.AtEOF() {
+		if t.scanner.Err() != nil {
+			return Token{}, t.scanner.Err()
+		}
+		return Token{}, io.EOF
+	}
+
+	if !t.scanner.StartsTag() {
+		text, text_err := readUntilTag(t.scanner)
+		if text_err != nil {
+			return Token{}, text_err
+		}
+		return Token{Type: TOKEN_TEXT, Data: decodeCharacterReferences(string(text), false), Raw: string(text), Start: start, End: t.scanner.Location()}, nil
+	}
+
+	token, token_err := readTagToken(t.scanner, mark)
+	token.Start = start
+	token.End = t.scanner.Location()
+	if parse_error, is_parse_error := token_err.(*ParseError); is_parse_error {
+		//the markup is recovered from the way browsers do: `</>` is dropped and anything else follows the error.
+		if parse_error.Code != PARSE_ERROR_EMPTY_TAG {
+			t.pending = append(t.pending, token)
+		}
+		return Token{}, parse_error
+	} else if token_err != nil {
+		return token, token_err
+	}
+
+	if token.Type == TOKEN_START_TAG && (token.Name == ELEMENT_SCRIPT || RAW_TEXT_ELEMENTS[token.Name] || RCDATA_ELEMENTS[token.Name]) {
+		t.rawText = token.Name
+	}
+	return token, nil
+}
+
+// readRawText reads the contents of a script, raw text or RCDATA element, queueing the close tag to follow it.
+func (t *Tokenizer) readRawText(start Location, elementName string) (Token, error) {
+	var contents []rune
+	var is_closed bool
+	var read_err error
+	if elementName == ELEMENT_SCRIPT {
+		contents, is_closed, read_err = readUntilScriptEnd(t.scanner)
+	} else {
+		contents, is_closed, read_err = readUntilEndTag(t.scanner, elementName)
+	}
+	if read_err != nil {
+		return Token{}, read_err
+	}
+
+	text := Token{Type: TOKEN_TEXT, Data: string(contents), Raw: string(contents), Start: start, End: start.Advance(string(contents))}
+	if RCDATA_ELEMENTS[elementName] {
+		text.Data = decodeCharacterReferences(text.Raw, false)
+	}
+	if is_closed {
+		t.pending = append(t.pending, Token{Type: TOKEN_END_TAG, Name: elementName, Start: text.End, End: t.scanner.Location()})
+	}
+
+	if len(contents) == 0 {
+		return t.Next()
+	}
+	return text, nil
+}
+
+// readTagToken runs the tag state machine from a `<`, with `mark` being the scanner mark the tag began at.
+func readTagToken(scanner *runeScanner, mark int) (Token, error) {
+	token := Token{Type: TOKEN_START_TAG}
+
+	state := 0
+
+	var attr_name, attr_value, element_name, data strings.Builder
+	const cdata_open = "CDATA["
+	cdata_matched := 0
+	var terminator rune
+	terminator_run := 0
+	is_bang := false
+	const quote_double = rune('"')
+	const quote_single = rune('\'')
+
+	var quote_character, attr_quote rune
+	var attr_start, before Location
+	var malformed *ParseError
+
+	set_attribute := func(end Location) {
+		value := attr_value.String()
+		token.Attributes = append(token.Attributes, Attribute{Name: strings.ToLower(attr_name.String()), Value: decodeCharacterReferences(value, true), Raw: value, Quote: attr_quote, Position: Position{Start: attr_start, End: end}})
+		attr_name.Reset()
+		attr_value.Reset()
+		attr_quote = 0
+	}
+
+	//flush_terminator adds the `]` or `?` runes held back while looking for the end of a cdata section or
+	//processing instruction to its data, keeping `keep` of them back.
+	flush_terminator := func(keep int) {
+		for ; terminator_run > keep; terminator_run-- {
+			data.WriteRune(terminator)
+		}
+	}
+	//read_until_terminator adds `c` to the data, returning true at the `>` of a `]]>` or `?>` (`length` being the
+	//number of `]` or `?` runes in it). Runs of `terminator` are counted rather than searched for in the data.
+	read_until_terminator := func(c rune, length int) bool {
+		if c == terminator {
+			terminator_run++
+			return false
+		} else if c == '>' && terminator_run >= length {
+			flush_terminator(length)
+			terminator_run = 0
+			return true
+		}
+		flush_terminator(0)
+		data.WriteRune(c)
+		return false
+	}
+
+	finish := func() (Token, error) {
+		token.Name = strings.ToLower(element_name.String())
+		flush_terminator(0)
+		token.Data = data.String()
+		if is_bang && token.Type == TOKEN_START_TAG {
+			raw := scanner.Source(mark)
+			raw = strings.TrimSuffix(strings.TrimPrefix(raw, "<!"), ">")
+			if token.Name == ELEMENT_DOCTYPE {
+				token.Type = TOKEN_DOCTYPE
+				token.Attributes = nil
+				token.Data = strings.TrimSpace(raw[len(ELEMENT_DOCTYPE):])
+			} else { //anything else starting with `<!` is a bogus comment.
+				token.Type = TOKEN_COMMENT
+				token.Name = EMPTY
+				token.Attributes = nil
+				token.Data = raw
+			}
+		}
+		if malformed != nil && scanner.Err() == nil {
+			return token, malformed
+		}
+		return token, scanner.Err()
+	}
+
+	for {
+		before = scanner.Location()
+		c, ok := scanner.Next()
+		if !ok {
+			break
+		}
+
+		switch state {
+		case 0: //read until tag begins
+			if c == '<' {
+				state = 1
+			}
+		case 1: //read preamble if any
+			if c == '!' {
+				is_bang = true
+				state = 3
+			} else if c == '?' && token.Type == TOKEN_START_TAG {
+				token.Type = TOKEN_PROCESSING_INSTRUCTION
+				terminator = '?'
+				state = 400
+			} else if c == '/' {
+				token.Type = TOKEN_END_TAG
+			} else if c == '>' {
+				return token, &ParseError{Code: PARSE_ERROR_EMPTY_TAG, Location: before}
+			} else if !isWhitespace(c) {
+				state = 10
+				element_name.WriteRune(c)
+			} //else is whitespace, keep going
+		case 3: //possible xml comment
+			if c == '-' {
+				state = 4
+			} else if c == '[' {
+				state = 300
+			} else {
+				scanner.Unread()
+				state = 1
+			}
+		case 4:
+			if c == '-' {
+				token.Type = TOKEN_COMMENT
+				state = 200 //consume xml comment
+			} else { //`<!-` without another `-` is a bogus comment.
+				malformed = &ParseError{Code: PARSE_ERROR_MALFORMED_COMMENT, Location: before}
+				state = 310
+				if c == '>' {
+					return finish()
+				}
+			}
+		case 10: //read elemName
+			if isWhitespace(c) && is_bang && strings.ToLower(element_name.String()) == ELEMENT_DOCTYPE {
+				state = 600
+			} else if isWhitespace(c) {
+				state = 20
+			} else if c == '>' {
+				return finish()
+			} else if c == '/' {
+				state = 500
+			} else {
+				element_name.WriteRune(c)
+			}
+		case 20: //read until attribute or end of tags
+			if c == '/' {
+				state = 500
+			} else if c == '>' {
+				return finish()
+			} else if !isWhitespace(c) {
+				scanner.Unread()
+				attr_start = scanner.Location()
+				state = 100
+			}
+		case 100: //read attribute name
+			if c == '=' { //we are assigning an attribute value ...
+				state = 101
+			} else if c == '/' {
+				set_attribute(before)
+				state = 500
+			} else if c == '>' {
+				set_attribute(before)
+				return finish()
+			} else if isWhitespace(c) {
+				set_attribute(before)
+				state = 20
+			} else {
+				attr_name.WriteRune(c)
+			}
+		case 101: //set attribute value quote
+			if c == quote_single || c == quote_double {
+				quote_character = c
+				attr_quote = c
+				state = 102
+			} else if c == '>' { //`name=>` ends the tag with the value empty.
+				set_attribute(before)
+				return finish()
+			} else if !isWhitespace(c) {
+				attr_value.WriteRune(c)
+				state = 103
+			}
+		case 102: //read attribute value
+			if c == quote_character {
+				set_attribute(scanner.Location())
+				state = 20
+			} else {
+				attr_value.WriteRune(c)
+			}
+		case 103: //read unquoted attribute value
+			if isWhitespace(c) {
+				set_attribute(before)
+				state = 20
+			} else if c == '>' {
+				set_attribute(before)
+				return finish()
+			} else {
+				attr_value.WriteRune(c)
+			}
+		case 200:
+			if c == '-' {
+				state = 201
+			} else {
+				data.WriteRune(c)
+			}
+		case 201:
+			if c == '-' {
+				state = 202
+			} else {
+				state = 200
+				data.WriteByte('-')
+				data.WriteRune(c)
+			}
+		case 202:
+			if c == '>' {
+				return finish()
+			} else if c == '-' {
+				data.WriteByte('-')
+			} else {
+				state = 200
+				data.WriteString("--")
+				data.WriteRune(c)
+			}
+		case 300: //possible cdata section, `<![CDATA[`
+			if c != rune(cdata_open[cdata_matched]) {
+				state = 310
+				if c == '>' {
+					return finish()
+				}
+			} else if cdata_matched++; cdata_matched == len(cdata_open) {
+				token.Type = TOKEN_CDATA
+				terminator = ']'
+				state = 301
+			}
+		case 301: //read cdata until `]]>`
+			if read_until_terminator(c, 2) {
+				return finish()
+			}
+		case 310: //bogus comment
+			if c == '>' {
+				return finish()
+			}
+		case 400: //read processing instruction until `?>`
+			if read_until_terminator(c, 1) {
+				return finish()
+			}
+		case 600: //read doctype until a `>` that isn't in a quoted id
+			if c == quote_single || c == quote_double {
+				quote_character = c
+				state = 601
+			} else if c == '>' {
+				return finish()
+			}
+		case 601:
+			if c == quote_character {
+				state = 600
+			}
+		case 500:
+			if c == '>' {
+				if token.Type == TOKEN_START_TAG {
+					token.Type = TOKEN_SELF_CLOSING_TAG
+				}
+				return finish()
+			}
+		}
+	}
+
+	return finish()
+}
@@ -0,0 +1,205 @@
+package html
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func readAllTokens(t *testing.T, body string) []Token {
+	tokenizer := NewTokenizer(strings.NewReader(body))
+	tokens := []Token{}
+	for {
+		token, token_err := tokenizer.Next()
+		if token_err == io.EOF {
+			return tokens
+		}
+		if token_err != nil {
+			t.Error(token_err.Error())
+			t.FailNow()
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+func TestTokenizer(t *testing.T) {
+	body := `<!DOCTYPE html><p class="a" id=b hidden>Hi &amp; bye<br/><!-- a-b --></p><script>if (a < b) { c(); }</script>`
+	tokens := readAllTokens(t, body)
+
+	expected := []Token{
+		{Type: TOKEN_DOCTYPE, Name: ELEMENT_DOCTYPE, Data: "html"},
+		{Type: TOKEN_START_TAG, Name: ELEMENT_P, Attributes: []Attribute{{Name: "class", Value: "a"}, {Name: "id", Value: "b"}, {Name: "hidden"}}},
+		{Type: TOKEN_TEXT, Data: "Hi & bye", Raw: "Hi &amp; bye"},
+		{Type: TOKEN_SELF_CLOSING_TAG, Name: ELEMENT_BR},
+		{Type: TOKEN_COMMENT, Data: " a-b "},
+		{Type: TOKEN_END_TAG, Name: ELEMENT_P},
+		{Type: TOKEN_START_TAG, Name: ELEMENT_SCRIPT},
+		{Type: TOKEN_TEXT, Data: "if (a < b) { c(); }"},
+		{Type: TOKEN_END_TAG, Name: ELEMENT_SCRIPT},
+	}
+
+	if len(tokens) != len(expected) {
+		t.Errorf("token count is %d, expected %d", len(tokens), len(expected))
+		t.FailNow()
+	}
+
+	for x, token := range tokens {
+		if token.Type != expected[x].Type || token.Name != expected[x].Name || token.Data != expected[x].Data || (expected[x].Raw != EMPTY && token.Raw != expected[x].Raw) {
+			t.Errorf("token %d is %s %q %q, expected %s %q %q", x, token.Type, token.Name, token.Data, expected[x].Type, expected[x].Name, expected[x].Data)
+		}
+		if len(token.Attributes) != len(expected[x].Attributes) {
+			t.Errorf("token %d has %d attributes, expected %d", x, len(token.Attributes), len(expected[x].Attributes))
+			continue
+		}
+		for y, attr := range token.Attributes {
+			if attr.Name != expected[x].Attributes[y].Name || attr.Value != expected[x].Attributes[y].Value {
+				t.Errorf("token %d attribute %d is %v, expected %v", x, y, attr, expected[x].Attributes[y])
+			}
+		}
+	}
+
+	source := []byte(body)
+	if string(source[tokens[1].Start.Offset:tokens[1].End.Offset]) != `<p class="a" id=b hidden>` {
+		t.Errorf("start tag offsets are wrong: %d-%d", tokens[1].Start.Offset, tokens[1].End.Offset)
+	}
+	for _, attr := range tokens[1].Attributes {
+		if raw := string(source[attr.Position.Start.Offset:attr.Position.End.Offset]); !strings.HasPrefix(raw, attr.Name) || strings.HasSuffix(raw, " ") {
+			t.Errorf("attribute %s offsets are wrong: %q", attr.Name, raw)
+		}
+	}
+	if string(source[tokens[7].Start.Offset:tokens[7].End.Offset]) != "if (a < b) { c(); }" {
+		t.Errorf("script text offsets are wrong: %d-%d", tokens[7].Start.Offset, tokens[7].End.Offset)
+	}
+	if tokens[len(tokens)-1].End.Offset != len(source) {
+		t.Error("the last token should end at the end of the input")
+	}
+}
+
+func TestTokenizerExtractLinks(t *testing.T) {
+	tokenizer := NewTokenizer(strings.NewReader(readFileContents("mocks/news.ycombinator.com.html")))
+
+	hrefs := []string{}
+	for {
+		token, token_err := tokenizer.Next()
+		if token_err == io.EOF {
+			break
+		}
+		if token_err != nil {
+			t.Error(token_err.Error())
+			t.FailNow()
+		}
+		if token.Type == TOKEN_START_TAG && token.Name == ELEMENT_A {
+			if href, has_href := token.Attr("href"); has_href {
+				hrefs = append(hrefs, href)
+			}
+		}
+	}
+
+	doc, _ := Parse(readFileContents("mocks/news.ycombinator.com.html"))
+	expected, _ := doc.QuerySelectorAll("a[href]")
+	if len(hrefs) == 0 || len(hrefs) != len(expected) {
+		t.Errorf("tokenizer found %d links, expected %d", len(hrefs), len(expected))
+		t.FailNow()
+	}
+}
+
+func TestTokenizerBogusComment(t *testing.T) {
+	tokens := readAllTokens(t, `<![if IE]>text`)
+	if len(tokens) != 2 || tokens[0].Type != TOKEN_COMMENT || tokens[0].Data != "[if IE]" {
+		t.Error("`<!` markup that isn't a comment or doctype should be a bogus comment")
+		t.FailNow()
+	}
+}
+
+func TestTokenizerEmptyAttributeValue(t *testing.T) {
+	tokens := readAllTokens(t, `<a href=>text</a><b id= >x</b>`)
+	if len(tokens) != 6 || tokens[0].Type != TOKEN_START_TAG || len(tokens[0].Attributes) != 1 || tokens[0].Attributes[0].Value != EMPTY || tokens[1].Data != "text" {
+		t.Errorf("a `>` after `=` should end the tag, got %v", tokens)
+		t.FailNow()
+	}
+	if len(tokens[3].Attributes) != 1 || tokens[3].Attributes[0].Name != "id" || tokens[3].Attributes[0].Value != EMPTY || tokens[4].Data != "x" {
+		t.Errorf("a `>` after `= ` should end the tag, got %v", tokens[3])
+	}
+}
+
+func TestTokenizerLessThanText(t *testing.T) {
+	testCases := map[string]string{
+		`a < b`:     `a < b`,
+		`1<2`:       `1<2`,
+		`x <= y`:    `x <= y`,
+		`a <> b`:    `a <> b`,
+		`trailing<`: `trailing<`,
+	}
+	for body, expected := range testCases {
+		tokens := readAllTokens(t, body)
+		if len(tokens) != 1 || tokens[0].Type != TOKEN_TEXT || tokens[0].Data != expected {
+			t.Errorf("%s tokenized as %v", body, tokens)
+		}
+	}
+
+	tokens := readAllTokens(t, `<p>a < b and 1<2</p>`)
+	if len(tokens) != 3 || tokens[1].Type != TOKEN_TEXT || tokens[1].Data != `a < b and 1<2` || tokens[2].Type != TOKEN_END_TAG {
+		t.Errorf("a `<` that doesn't start a tag should stay in the text, got %v", tokens)
+	}
+}
+
+func TestTokenizerTerminators(t *testing.T) {
+	testCases := []struct {
+		body     string
+		kind     TokenType
+		expected string
+	}{
+		{`<!-- a - b -- c --->`, TOKEN_COMMENT, ` a - b -- c -`},
+		{`<![CDATA[a]b]]c]]>`, TOKEN_CDATA, `a]b]]c`},
+		{`<![CDATA[a]]]>`, TOKEN_CDATA, `a]`},
+		{`<![CDATA[unclosed]]`, TOKEN_CDATA, `unclosed]]`},
+		{`<?xml a="?"??>`, TOKEN_PROCESSING_INSTRUCTION, `xml a="?"?`},
+		{`<?pi ?x?>`, TOKEN_PROCESSING_INSTRUCTION, `pi ?x`},
+	}
+	for _, testCase := range testCases {
+		tokens := readAllTokens(t, testCase.body)
+		if len(tokens) != 1 || tokens[0].Type != testCase.kind || tokens[0].Data != testCase.expected {
+			t.Errorf("%s tokenized as %v", testCase.body, tokens)
+		}
+	}
+
+	long := strings.Repeat("]-?", 100000)
+	for _, body := range []string{"<!--" + long + "-->", "<![CDATA[" + long + "]]>", "<?" + long + "?>"} {
+		if tokens := readAllTokens(t, body); len(tokens) != 1 || tokens[0].Data != long {
+			t.Errorf("a long %s wasn't read whole", tokens[0].Type)
+		}
+	}
+}
+
+func TestTokenizerRawText(t *testing.T) {
+	testCases := map[string]string{
+		`<style>a > b { content: "</p>"; }</style>`:   `a > b { content: "</p>"; }`,
+		`<textarea><b>bold</b> &amp; &lt;</textarea>`: `<b>bold</b> & <`,
+		`<title>A &amp; <i>B</i></TITLE >`:            `A & <i>B</i>`,
+		`<xmp><div>&amp;</div></xmp>`:                 `<div>&amp;</div>`,
+		`<noscript><img src="x.gif"></noscript>`:      `<img src="x.gif">`,
+		`<style></styles></style>`:                    `</styles>`,
+		`<style><</style>`:                            `<`,
+	}
+
+	for body, expected := range testCases {
+		tokens := readAllTokens(t, body)
+		if len(tokens) != 3 || tokens[1].Type != TOKEN_TEXT || tokens[1].Data != expected || tokens[2].Type != TOKEN_END_TAG || tokens[2].Name != tokens[0].Name {
+			t.Errorf("%s tokenized as %v", body, tokens)
+			continue
+		}
+		if tokens[2].End.Offset != len(body) || body[tokens[1].End.Offset:tokens[2].Start.Offset] != "" {
+			t.Errorf("%s close tag offsets are wrong", body)
+		}
+	}
+
+	tokens := readAllTokens(t, `<plaintext></plaintext><b>`)
+	if len(tokens) != 2 || tokens[1].Data != `</plaintext><b>` {
+		t.Errorf("plaintext should run to the end of the input, got %v", tokens)
+	}
+
+	tokens = readAllTokens(t, `<textarea>unclosed <b>`)
+	if len(tokens) != 2 || tokens[1].Data != `unclosed <b>` {
+		t.Errorf("an unclosed textarea should run to the end of the input, got %v", tokens)
+	}
+}
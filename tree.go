@@ -0,0 +1,229 @@
+package html
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+//--------------------------------------------------------------------------------
+// TREE MUTATION
+//--------------------------------------------------------------------------------
+
+var (
+	// ErrNoParent is returned when an element has to be in a tree for a change to be made, such as ReplaceWith.
+	ErrNoParent = errors.New("html: element has no parent")
+	// ErrNotChild is returned by RemoveChild for an element that isn't a child of the one it's removed from.
+	ErrNotChild = errors.New("html: element is not a child")
+	// ErrCycle is returned when an element would be moved inside itself.
+	ErrCycle = errors.New("html: element can't be moved inside itself")
+)
+
+// An element that's added somewhere while it's still in a tree is moved, the way the browser dom does it.
+
+// PrependChild adds `newChild` as the first child of the element.
+func (e *Element) PrependChild(newChild *Element) error {
+	return insertChild(e, newChild, e.FirstChild)
+}
+
+// RemoveChild takes `child` out of the element's children.
+func (e *Element) RemoveChild(child *Element) error {
+	if child.Parent != e {
+		return ErrNotChild
+	}
+	child.Detach()
+	return nil
+}
+
+// InsertBefore adds `node` to the tree as the sibling just before the element.
+func (e *Element) InsertBefore(node *Element) error {
+	if e.Parent == nil {
+		return ErrNoParent
+	}
+	return insertChild(e.Parent, node, e)
+}
+
+// InsertAfter adds `node` to the tree as the sibling just after the element.
+func (e *Element) InsertAfter(node *Element) error {
+	if e.Parent == nil {
+		return ErrNoParent
+	}
+	return insertChild(e.Parent, node, e.NextSibling)
+}
+
+// ReplaceWith puts `node` where the element is in the tree, detaching the element.
+func (e *Element) ReplaceWith(node *Element) error {
+	if node == e {
+		return nil
+	}
+	if insert_err := e.InsertBefore(node); insert_err != nil {
+		return insert_err
+	}
+	e.Detach()
+	return nil
+}
+
+// Wrap puts `wrapper` where the element is in the tree and moves the element inside it, after any children it has.
+func (e *Element) Wrap(wrapper *Element) error {
+	if isAncestorOrSelf(e, wrapper) {
+		return ErrCycle
+	}
+	if insert_err := e.InsertBefore(wrapper); insert_err != nil {
+		return insert_err
+	}
+	return insertChild(wrapper, e, nil)
+}
+
+// Unwrap replaces the element with its children.
+func (e *Element) Unwrap() error {
+	if e.Parent == nil {
+		return ErrNoParent
+	}
+	for e.FirstChild != nil {
+		if insert_err := insertChild(e.Parent, e.FirstChild, e); insert_err != nil {
+			return insert_err
+		}
+	}
+	e.Detach()
+	return nil
+}
+
+// Detach takes the element out of the tree it's in, keeping its own children. It does nothing if the element has no parent.
+func (e *Element) Detach() {
+	if parent := e.Parent; parent != nil {
+		if e.PrevSibling != nil {
+			e.PrevSibling.NextSibling = e.NextSibling
+		} else {
+			parent.FirstChild = e.NextSibling
+		}
+		if e.NextSibling != nil {
+			e.NextSibling.PrevSibling = e.PrevSibling
+		} else {
+			parent.LastChild = e.PrevSibling
+		}
+	}
+	e.Parent = nil
+	e.PrevSibling = nil
+	e.NextSibling = nil
+}
+
+// SetInnerHTML replaces the element's children with `body` parsed as a fragment in the element's context,
+// so it's read as svg inside an `<svg>` and as text inside a `<script>` or `<textarea>`.
+func (e *Element) SetInnerHTML(body string) error {
+	fragment, parse_err := parseFragmentIn(e, body)
+	if parse_err != nil {
+		return parse_err
+	}
+
+	for e.FirstChild != nil {
+		e.FirstChild.Detach()
+	}
+	for fragment.FirstChild != nil {
+		if insert_err := insertChild(e, fragment.FirstChild, nil); insert_err != nil {
+			return insert_err
+		}
+	}
+	e.SourceHTML = body
+	return nil
+}
+
+// Clone returns a detached copy of the element with its own attributes, and copies of its children too if `deep` is set.
+func (e *Element) Clone(deep bool) *Element {
+	clone := *e
+	clone.Parent, clone.PrevSibling, clone.NextSibling = nil, nil, nil
+	clone.FirstChild, clone.LastChild = nil, nil
+
+	if e.Attributes != nil {
+		clone.Attributes = make(map[string]string, len(e.Attributes))
+		for name, value := range e.Attributes {
+			clone.Attributes[name] = value
+		}
+	}
+	clone.attributeList = append([]Attribute(nil), e.attributeList...)
+	if e.Doctype != nil {
+		doctype := *e.Doctype
+		clone.Doctype = &doctype
+	}
+
+	if deep {
+		for child := e.FirstChild; child != nil; child = child.NextSibling {
+			clone.AddChild(child.Clone(true))
+		}
+	}
+	return &clone
+}
+
+// insertChild adds `child` to `parent` just before `before`, or at the end if `before` is nil. Nothing is
+// changed unless the insert can be made.
+func insertChild(parent, child, before *Element) error {
+	if isAncestorOrSelf(child, parent) {
+		return ErrCycle
+	}
+	if before != nil && before.Parent != parent {
+		return ErrNotChild
+	}
+	if before == child {
+		return nil
+	}
+	child.Detach()
+
+	child.Parent = parent
+	child.NextSibling = before
+	if before != nil {
+		child.PrevSibling = before.PrevSibling
+		before.PrevSibling = child
+	} else {
+		child.PrevSibling = parent.LastChild
+		parent.LastChild = child
+	}
+	if child.PrevSibling != nil {
+		child.PrevSibling.NextSibling = child
+	} else {
+		parent.FirstChild = child
+	}
+	return nil
+}
+
+// isAncestorOrSelf returns if `e` is `node` or one of its ancestors.
+func isAncestorOrSelf(e, node *Element) bool {
+	for ; node != nil; node = node.Parent {
+		if node == e {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFragmentIn parses `body` as the contents of `context`, returning a root holding the parsed nodes.
+func parseFragmentIn(context *Element, body string) (*Element, error) {
+	root := &Element{IsRoot: true, ElementName: context.ElementName, Namespace: context.Namespace}
+	tokenizer := NewTokenizer(strings.NewReader(body))
+
+	raw_text := context.ElementName == ELEMENT_SCRIPT || RAW_TEXT_ELEMENTS[context.ElementName] || RCDATA_ELEMENTS[context.ElementName]
+	if raw_text && !isForeignNamespace(context.Namespace) {
+		text, text_err := tokenizer.readRawText(Location{Line: 1, Column: 1}, context.ElementName)
+		if text_err != nil && text_err != io.EOF {
+			return nil, text_err
+		}
+		if len(text.Raw) > 0 {
+			root.AddChild(newElementFromToken(text))
+		}
+		return root, nil
+	}
+
+	//the context and the elements around it start out open, so the fragment is built the way it would be there.
+	ancestors := []*Element{}
+	for ancestor := context; ancestor != nil && !ancestor.IsRoot; ancestor = ancestor.Parent {
+		ancestors = append(ancestors, ancestor)
+	}
+	tagStack := &elementStack{}
+	for x := len(ancestors) - 1; x >= 0; x-- {
+		tagStack.Push(*ancestors[x])
+	}
+
+	builder := &treeBuilder{openElements: []*Element{root}}
+	state := &parseState{fragment: true, source: body, hasSource: true, baseDepth: tagStack.Count, sawHead: tagStack.Contains(ELEMENT_HEAD) || tagStack.Contains(ELEMENT_BODY)}
+	parse_err := parseChildren(root, tokenizer, tagStack, state, builder)
+	builder.Finish()
+	return root, parse_err
+}
@@ -0,0 +1,176 @@
+package html
+
+import (
+	"strings"
+	"testing"
+)
+
+// checkLinks fails the test if the parent, sibling and first / last child links under `e` don't agree with each other.
+func checkLinks(t *testing.T, e *Element) {
+	var previous *Element
+	for x, child := range e.Children() {
+		if child.Parent != e || child.PrevSibling != previous || (x == 0 && e.FirstChild != child) {
+			t.Errorf("the links of %s in %s are wrong", outline(child), outline(e))
+		}
+		if previous != nil && previous.NextSibling != child {
+			t.Errorf("the next sibling of %s is wrong", outline(previous))
+		}
+		previous = child
+		checkLinks(t, child)
+	}
+	if e.LastChild != previous || (previous != nil && previous.NextSibling != nil) {
+		t.Errorf("the last child of %s is wrong", outline(e))
+	}
+}
+
+func TestMutation(t *testing.T) {
+	doc, _ := ParseFragment("<div><p>a</p><p>b</p><span>c</span></div>")
+	div := doc.Children()[0]
+	first, second, span := div.Children()[0], div.Children()[1], div.Children()[2]
+
+	testCases := []struct {
+		change   func() error
+		expected string
+	}{
+		{func() error { return span.InsertBefore(first) }, "div(p(b),p(a),span(c))"},
+		{func() error { return second.InsertAfter(span) }, "div(p(b),span(c),p(a))"},
+		{func() error { return div.PrependChild(first) }, "div(p(a),p(b),span(c))"},
+		{func() error { return div.RemoveChild(second) }, "div(p(a),span(c))"},
+		{func() error { return span.ReplaceWith(second) }, "div(p(a),p(b))"},
+		{func() error { return first.Wrap(span) }, "div(span(c,p(a)),p(b))"},
+		{func() error { return span.Unwrap() }, "div(c,p(a),p(b))"},
+		{func() error { second.Detach(); return nil }, "div(c,p(a))"},
+		{func() error { div.AddChild(second); return nil }, "div(c,p(a),p(b))"},
+	}
+	for x, testCase := range testCases {
+		if change_err := testCase.change(); change_err != nil {
+			t.Errorf("change %d failed with %s", x, change_err.Error())
+		}
+		if actual := outline(doc); actual != testCase.expected {
+			t.Errorf("change %d left %s, expected %s", x, actual, testCase.expected)
+		}
+		checkLinks(t, doc)
+	}
+
+	if span.Parent != nil || span.NextSibling != nil || span.PrevSibling != nil {
+		t.Error("an unwrapped element should be detached")
+	}
+	if div.RemoveChild(span) != ErrNotChild {
+		t.Error("removing an element that isn't a child should fail")
+	}
+	if span.InsertBefore(first) != ErrNoParent || span.Unwrap() != ErrNoParent || span.ReplaceWith(first) != ErrNoParent {
+		t.Error("changes around a detached element should fail")
+	}
+	if first.Wrap(first) != ErrCycle || first.PrependChild(div) != ErrCycle {
+		t.Error("moving an element inside itself should fail")
+	}
+	if insertChild(doc, second, span) != ErrNotChild || second.Parent != div {
+		t.Error("inserting before an element of another parent should fail without moving anything")
+	}
+	if !strings.HasPrefix(outline(doc), "div(") {
+		t.Error("failed changes shouldn't change the tree")
+	}
+
+	div.FirstChild.Detach()
+	if children := div.Children(); len(children) != 2 || children[0] != first || children[1] != second {
+		t.Error("the children should follow the sibling links")
+	}
+}
+
+func TestSetInnerHTML(t *testing.T) {
+	doc, _ := Parse("<html><head><script></script></head><body><div id=main><p>old</p></div><svg></svg></body></html>")
+	main := doc.GetElementById("main")
+	old := main.Children()[0]
+
+	if set_err := main.SetInnerHTML("<p>one<p>two <b>bold</b>"); set_err != nil {
+		t.Error(set_err.Error())
+		t.FailNow()
+	}
+	if actual := outline(main); actual != "div(p(one),p(two ,b(bold)))" {
+		t.Errorf("new contents parsed as %s", actual)
+	}
+	if old.Parent != nil || main.InnerHTML() != "<p>one</p><p>two <b>bold</b></p>" {
+		t.Error("the old contents should be detached")
+	}
+	checkLinks(t, doc)
+
+	script, _ := doc.QuerySelector("script")
+	script.SetInnerHTML("if (a < b) { track('<p>'); }")
+	if len(script.Children()) != 1 || script.Children()[0].Text != "if (a < b) { track('<p>'); }" {
+		t.Errorf("script contents parsed as %s", outline(script))
+	}
+
+	svg, _ := doc.QuerySelector("svg")
+	svg.SetInnerHTML(`<linearGradient gradientUnits="userSpaceOnUse"/><p>html</p>`)
+	if actual := outline(svg); actual != "svg(linearGradient,p(html))" || svg.Children()[0].Namespace != NAMESPACE_SVG {
+		t.Errorf("svg contents parsed as %s", actual)
+	}
+}
+
+func TestSetInnerHTMLContext(t *testing.T) {
+	doc, _ := Parse("<div id=main></div><table><tbody><tr><td id=cell></td></tr></tbody></table><ul><li id=item></li></ul>")
+
+	testCases := []struct {
+		id       string
+		html     string
+		expected string
+	}{
+		{"main", "<tr><td>x", "div(x)"},
+		{"main", "<p>a</div>b", "div(p(ab))"},
+		{"main", "<body><p>a", "div(p(a))"},
+		{"cell", "<p>a<td>b", "td(p(ab))"},
+		{"item", "a<li>b", "li(a,li(b))"},
+	}
+	for _, testCase := range testCases {
+		e := doc.GetElementById(testCase.id)
+		if set_err := e.SetInnerHTML(testCase.html); set_err != nil {
+			t.Error(set_err.Error())
+			continue
+		}
+		if actual := outline(e); actual != testCase.expected {
+			t.Errorf("%s set in #%s parsed as %s, expected %s", testCase.html, testCase.id, actual, testCase.expected)
+		}
+	}
+
+	table, _ := doc.QuerySelector("table")
+	table.SetInnerHTML("<tr><td>x")
+	if actual := outline(table); actual != "table(tbody(tr(td(x))))" {
+		t.Errorf("table contents parsed as %s", actual)
+	}
+	checkLinks(t, doc)
+
+	if fragment, _ := ParseFragment("<tr><td>x"); outline(fragment) != "tr(td(x))" {
+		t.Errorf("a fragment without a context should keep its rows, got %s", outline(fragment))
+	}
+}
+
+func TestClone(t *testing.T) {
+	doc, _ := ParseFragment(`<ul><li class="card"><a href="/one">one</a></li></ul>`)
+	ul := doc.Children()[0]
+	card := ul.Children()[0]
+
+	shallow := card.Clone(false)
+	if shallow.Parent != nil || len(shallow.Children()) != 0 || shallow.FirstChild != nil || shallow.Attributes["class"] != "card" {
+		t.Error("a shallow clone should be a detached copy without children")
+	}
+
+	deep := card.Clone(true)
+	deep.AddClass("copy")
+	deep.Children()[0].SetAttr("href", "/two")
+	deep.Children()[0].Children()[0].Text = "two"
+	ul.AddChild(deep)
+
+	if card.Attributes["class"] != "card" || card.Children()[0].Attributes["href"] != "/one" || card.Children()[0].Children()[0].Text != "one" {
+		t.Error("changing a clone shouldn't change the original")
+	}
+	if deep.Attributes["class"] != "card copy" || deep.Children()[0].Parent != deep || deep.Children()[0].Children()[0].Parent != deep.Children()[0] {
+		t.Error("a deep clone's children should belong to it")
+	}
+	if actual := outline(doc); actual != "ul(li(a(one)),li(a(two)))" {
+		t.Errorf("the list is %s", actual)
+	}
+	checkLinks(t, doc)
+	if !strings.Contains(deep.ToString(), `class="card copy"`) || !strings.Contains(card.ToString(), `class="card"`) {
+		t.Error("the clone's attribute list should be its own")
+	}
+}
@@ -0,0 +1,1440 @@
+package html
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//--------------------------------------------------------------------------------
+// TYPES: XPATH NODES
+//--------------------------------------------------------------------------------
+
+// xpathNode wraps an element with the document order and attribute nodes the `Element` tree doesn't keep
+// itself. Nodes are made as a query reaches them, so a query only pays for the part of the tree it visits.
+type xpathNode struct {
+	Element *Element
+
+	IsDocument  bool
+	IsAttribute bool
+	AttrName    string
+	AttrValue   string
+
+	document   *xpathDocument
+	owner      *xpathNode
+	children   []*xpathNode
+	attributes []*xpathNode
+	indexed    bool
+	index      int
+	path       []int
+}
+
+// xpathDocument hands out one node per element for the length of a query, so node-sets can be compared by identity.
+type xpathDocument struct {
+	root  *xpathNode
+	top   *Element
+	nodes map[*Element]*xpathNode
+}
+
+// newXpathDocument returns the node for `e` in the document containing it. `e` can be a copy of an element
+// in the tree (as the value receivers make it), in which case the tree's own pointer is used.
+func newXpathDocument(e *Element) *xpathNode {
+	if e.PrevSibling != nil {
+		e = e.PrevSibling.NextSibling
+	} else if e.Parent != nil {
+		e = e.Parent.FirstChild
+	} else if e.FirstChild != nil {
+		e = e.FirstChild.Parent
+	}
+
+	top := e
+	for top.Parent != nil {
+		top = top.Parent
+	}
+
+	document := &xpathDocument{top: top, nodes: map[*Element]*xpathNode{}}
+	document.root = &xpathNode{IsDocument: true, document: document}
+	if top.IsRoot {
+		document.root.Element = top
+		document.nodes[top] = document.root
+	}
+	return document.node(e)
+}
+
+func (d *xpathDocument) node(e *Element) *xpathNode {
+	if node, has_node := d.nodes[e]; has_node {
+		return node
+	}
+	node := &xpathNode{Element: e, document: d}
+	d.nodes[e] = node
+	return node
+}
+
+// Parent is the element or document containing the node; for an attribute, it's the element the attribute is on.
+func (n *xpathNode) Parent() *xpathNode {
+	if n.IsAttribute {
+		return n.owner
+	} else if n.IsDocument {
+		return nil
+	} else if n.Element.Parent != nil {
+		return n.document.node(n.Element.Parent)
+	}
+	return n.document.root
+}
+
+func (n *xpathNode) Children() []*xpathNode {
+	if n.indexed {
+		return n.children
+	}
+	n.indexed = true
+	if n.IsDocument && n.Element == nil { //the document node above a detached element.
+		n.children = []*xpathNode{n.document.node(n.document.top)}
+	} else if !n.IsAttribute {
+		for child := n.Element.FirstChild; child != nil; child = child.NextSibling {
+			node := n.document.node(child)
+			node.index = len(n.children)
+			n.children = append(n.children, node)
+		}
+	}
+	return n.children
+}
+
+func (n *xpathNode) Attributes() []*xpathNode {
+	if n.attributes != nil || !n.IsElement() {
+		return n.attributes
+	}
+	n.attributes = []*xpathNode{}
+	seen := map[string]bool{}
+	for _, attr := range n.Element.AttributeList() {
+		if seen[attr.Name] {
+			continue
+		}
+		seen[attr.Name] = true
+		n.attributes = append(n.attributes, &xpathNode{IsAttribute: true, AttrName: attr.Name, AttrValue: attr.Value, document: n.document, owner: n, index: len(n.attributes)})
+	}
+	return n.attributes
+}
+
+// Path is the child indexes leading from the document to the node, or to the element an attribute is on.
+func (n *xpathNode) Path() []int {
+	if n.IsAttribute {
+		return n.owner.Path()
+	} else if n.path == nil {
+		n.path = []int{}
+		if parent := n.Parent(); parent != nil {
+			n.path = append(append(n.path, parent.Path()...), xpathChildIndex(n))
+		}
+	}
+	return n.path
+}
+
+// Before returns if `n` comes before `other` in document order, where an element's attributes come after it
+// and before its children.
+func (n *xpathNode) Before(other *xpathNode) bool {
+	path, other_path := n.Path(), other.Path()
+	for x := 0; x < len(path) && x < len(other_path); x++ {
+		if path[x] != other_path[x] {
+			return path[x] < other_path[x]
+		}
+	}
+	if len(path) != len(other_path) {
+		return len(path) < len(other_path)
+	}
+	if n.IsAttribute != other.IsAttribute {
+		return other.IsAttribute
+	}
+	return n.IsAttribute && n.index < other.index
+}
+
+func (n *xpathNode) IsElement() bool {
+	return !n.IsDocument && !n.IsAttribute && isElementNode(n.Element)
+}
+
+func (n *xpathNode) Name() string {
+	if n.IsAttribute {
+		return n.AttrName
+	} else if n.IsElement() {
+		return n.Element.ElementName
+	}
+	return EMPTY
+}
+
+func (n *xpathNode) StringValue() string {
+	if n.IsAttribute {
+		return n.AttrValue
+	}
+	if n.Element != nil && (n.Element.IsText || n.Element.IsCData) {
+		return n.Element.Text
+	} else if n.Element != nil && (n.Element.IsComment || n.Element.IsProcessingInstruction) {
+		return n.Element.Text
+	}
+
+	text := []string{}
+	for _, child := range n.Children() {
+		if child.Element.IsText || child.Element.IsCData {
+			text = append(text, child.Element.Text)
+		} else if !child.Element.IsComment && !child.Element.IsProcessingInstruction && !child.Element.IsDoctype {
+			text = append(text, child.StringValue())
+		}
+	}
+	return strings.Join(text, EMPTY)
+}
+
+func (n *xpathNode) Document() *xpathNode {
+	return n.document.root
+}
+
+// ToElement converts the node back into an `Element`; attribute nodes become text nodes holding the attribute value.
+func (n *xpathNode) ToElement() *Element {
+	if n.IsAttribute {
+		text := newTextNode(n.AttrValue)
+		text.Parent = n.owner.Element
+		return text
+	}
+	if n.Element == nil { //the document node above a detached element, which is left where it is.
+		return &Element{IsRoot: true, FirstChild: n.document.top, LastChild: n.document.top}
+	}
+	return n.Element
+}
+
+func sortXpathNodes(nodes []*xpathNode) []*xpathNode {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Before(nodes[j])
+	})
+
+	results := []*xpathNode{}
+	for x, node := range nodes {
+		if x == 0 || node != nodes[x-1] {
+			results = append(results, node)
+		}
+	}
+	return results
+}
+
+//--------------------------------------------------------------------------------
+// XPATH AXES
+//--------------------------------------------------------------------------------
+
+const (
+	XPATH_AXIS_ANCESTOR           = "ancestor"
+	XPATH_AXIS_ANCESTOR_OR_SELF   = "ancestor-or-self"
+	XPATH_AXIS_ATTRIBUTE          = "attribute"
+	XPATH_AXIS_CHILD              = "child"
+	XPATH_AXIS_DESCENDANT         = "descendant"
+	XPATH_AXIS_DESCENDANT_OR_SELF = "descendant-or-self"
+	XPATH_AXIS_FOLLOWING          = "following"
+	XPATH_AXIS_FOLLOWING_SIBLING  = "following-sibling"
+	XPATH_AXIS_NAMESPACE          = "namespace"
+	XPATH_AXIS_PARENT             = "parent"
+	XPATH_AXIS_PRECEDING          = "preceding"
+	XPATH_AXIS_PRECEDING_SIBLING  = "preceding-sibling"
+	XPATH_AXIS_SELF               = "self"
+)
+
+// xpathAxis returns the nodes along `axis` from `n` in axis order, i.e. reverse axes come nearest first.
+func xpathAxis(axis string, n *xpathNode) []*xpathNode {
+	switch axis {
+	case XPATH_AXIS_SELF:
+		return []*xpathNode{n}
+	case XPATH_AXIS_CHILD:
+		return n.Children()
+	case XPATH_AXIS_ATTRIBUTE:
+		return n.Attributes()
+	case XPATH_AXIS_PARENT:
+		if n.Parent() != nil {
+			return []*xpathNode{n.Parent()}
+		}
+		return nil
+	case XPATH_AXIS_ANCESTOR, XPATH_AXIS_ANCESTOR_OR_SELF:
+		nodes := []*xpathNode{}
+		if axis == XPATH_AXIS_ANCESTOR_OR_SELF {
+			nodes = append(nodes, n)
+		}
+		for ancestor := n.Parent(); ancestor != nil; ancestor = ancestor.Parent() {
+			nodes = append(nodes, ancestor)
+		}
+		return nodes
+	case XPATH_AXIS_DESCENDANT, XPATH_AXIS_DESCENDANT_OR_SELF:
+		nodes := []*xpathNode{}
+		if axis == XPATH_AXIS_DESCENDANT_OR_SELF {
+			nodes = append(nodes, n)
+		}
+		return appendXpathDescendants(nodes, n)
+	case XPATH_AXIS_FOLLOWING_SIBLING, XPATH_AXIS_PRECEDING_SIBLING:
+		if n.Parent() == nil || n.IsAttribute {
+			return nil
+		}
+		siblings := n.Parent().Children()
+		index := xpathChildIndex(n)
+		if axis == XPATH_AXIS_FOLLOWING_SIBLING {
+			return siblings[index+1:]
+		}
+		nodes := []*xpathNode{}
+		for x := index - 1; x >= 0; x-- {
+			nodes = append(nodes, siblings[x])
+		}
+		return nodes
+	case XPATH_AXIS_FOLLOWING:
+		nodes := []*xpathNode{}
+		node := n
+		if node.IsAttribute {
+			node = node.Parent()
+			nodes = appendXpathDescendants(nodes, node)
+		}
+		for ; node.Parent() != nil; node = node.Parent() {
+			for _, sibling := range node.Parent().Children()[xpathChildIndex(node)+1:] {
+				nodes = append(nodes, sibling)
+				nodes = appendXpathDescendants(nodes, sibling)
+			}
+		}
+		return nodes
+	case XPATH_AXIS_PRECEDING:
+		nodes := []*xpathNode{}
+		node := n
+		if node.IsAttribute {
+			node = node.Parent()
+		}
+		for ; node.Parent() != nil; node = node.Parent() {
+			siblings := node.Parent().Children()
+			for x := xpathChildIndex(node) - 1; x >= 0; x-- {
+				subtree := appendXpathDescendants([]*xpathNode{siblings[x]}, siblings[x])
+				for y := len(subtree) - 1; y >= 0; y-- {
+					nodes = append(nodes, subtree[y])
+				}
+			}
+		}
+		return nodes
+	}
+	return nil
+}
+
+func appendXpathDescendants(nodes []*xpathNode, n *xpathNode) []*xpathNode {
+	for _, child := range n.Children() {
+		nodes = append(nodes, child)
+		nodes = appendXpathDescendants(nodes, child)
+	}
+	return nodes
+}
+
+func xpathChildIndex(n *xpathNode) int {
+	n.Parent().Children()
+	return n.index
+}
+
+//--------------------------------------------------------------------------------
+// XPATH EXPRESSIONS
+//--------------------------------------------------------------------------------
+
+type xpathContext struct {
+	Node     *xpathNode
+	Position int
+	Size     int
+}
+
+// xpathExpr evaluates to one of `[]*xpathNode`, `string`, `float64` or `bool`.
+type xpathExpr interface {
+	Evaluate(ctx xpathContext) (interface{}, error)
+}
+
+type xpathLiteral struct {
+	Value interface{}
+}
+
+func (l xpathLiteral) Evaluate(ctx xpathContext) (interface{}, error) {
+	return l.Value, nil
+}
+
+type xpathNegate struct {
+	Operand xpathExpr
+}
+
+func (n xpathNegate) Evaluate(ctx xpathContext) (interface{}, error) {
+	value, value_err := n.Operand.Evaluate(ctx)
+	if value_err != nil {
+		return nil, value_err
+	}
+	return -xpathNumber(value), nil
+}
+
+type xpathBinary struct {
+	Operator string
+	Left     xpathExpr
+	Right    xpathExpr
+}
+
+func (b xpathBinary) Evaluate(ctx xpathContext) (interface{}, error) {
+	left, left_err := b.Left.Evaluate(ctx)
+	if left_err != nil {
+		return nil, left_err
+	}
+
+	switch b.Operator { //and / or short circuit.
+	case "and":
+		if !xpathBoolean(left) {
+			return false, nil
+		}
+	case "or":
+		if xpathBoolean(left) {
+			return true, nil
+		}
+	}
+
+	right, right_err := b.Right.Evaluate(ctx)
+	if right_err != nil {
+		return nil, right_err
+	}
+
+	switch b.Operator {
+	case "and", "or":
+		return xpathBoolean(right), nil
+	case "|":
+		left_nodes, left_ok := left.([]*xpathNode)
+		right_nodes, right_ok := right.([]*xpathNode)
+		if !left_ok || !right_ok {
+			return nil, fmt.Errorf("xpath: operands of `|` must be node-sets")
+		}
+		return sortXpathNodes(append(append([]*xpathNode{}, left_nodes...), right_nodes...)), nil
+	case "+":
+		return xpathNumber(left) + xpathNumber(right), nil
+	case "-":
+		return xpathNumber(left) - xpathNumber(right), nil
+	case "*":
+		return xpathNumber(left) * xpathNumber(right), nil
+	case "div":
+		return xpathNumber(left) / xpathNumber(right), nil
+	case "mod":
+		return math.Mod(xpathNumber(left), xpathNumber(right)), nil
+	}
+	return xpathCompare(b.Operator, left, right), nil
+}
+
+const (
+	XPATH_NODE_TEST_NAME    = "name"
+	XPATH_NODE_TEST_NODE    = "node"
+	XPATH_NODE_TEST_TEXT    = "text"
+	XPATH_NODE_TEST_COMMENT = "comment"
+	XPATH_NODE_TEST_PI      = "processing-instruction"
+)
+
+type xpathStep struct {
+	Axis       string
+	NodeTest   string
+	Name       string
+	Predicates []xpathExpr
+}
+
+func (s *xpathStep) Test(n *xpathNode) bool {
+	switch s.NodeTest {
+	case XPATH_NODE_TEST_NODE:
+		return true
+	case XPATH_NODE_TEST_TEXT:
+		return !n.IsAttribute && n.Element != nil && (n.Element.IsText || n.Element.IsCData)
+	case XPATH_NODE_TEST_COMMENT:
+		return !n.IsAttribute && n.Element != nil && n.Element.IsComment
+	case XPATH_NODE_TEST_PI:
+		if n.IsAttribute || n.Element == nil || !n.Element.IsProcessingInstruction {
+			return false
+		}
+		//`processing-instruction('name')` only matches instructions with that target.
+		target := strings.Fields(n.Element.Text)
+		return s.Name == EMPTY || (len(target) > 0 && target[0] == s.Name)
+	}
+
+	if s.Axis == XPATH_AXIS_ATTRIBUTE {
+		if !n.IsAttribute {
+			return false
+		}
+	} else if !n.IsElement() {
+		return false
+	}
+
+	if s.Name == "*" {
+		return true
+	}
+	if strings.HasSuffix(s.Name, ":*") {
+		return true //namespaces are not tracked, so any prefix matches.
+	}
+	name := s.Name
+	if colon := strings.IndexRune(name, ':'); colon >= 0 {
+		name = name[colon+1:]
+	}
+	return strings.ToLower(name) == strings.ToLower(n.Name())
+}
+
+func (s *xpathStep) Apply(nodes []*xpathNode) ([]*xpathNode, error) {
+	results := []*xpathNode{}
+	for _, node := range nodes {
+		candidates := []*xpathNode{}
+		for _, candidate := range xpathAxis(s.Axis, node) {
+			if s.Test(candidate) {
+				candidates = append(candidates, candidate)
+			}
+		}
+
+		for _, predicate := range s.Predicates {
+			filtered, filter_err := applyXpathPredicate(predicate, candidates)
+			if filter_err != nil {
+				return nil, filter_err
+			}
+			candidates = filtered
+		}
+		results = append(results, candidates...)
+	}
+	return sortXpathNodes(results), nil
+}
+
+func applyXpathPredicate(predicate xpathExpr, nodes []*xpathNode) ([]*xpathNode, error) {
+	results := []*xpathNode{}
+	for x, node := range nodes {
+		value, value_err := predicate.Evaluate(xpathContext{Node: node, Position: x + 1, Size: len(nodes)})
+		if value_err != nil {
+			return nil, value_err
+		}
+
+		if number, is_number := value.(float64); is_number {
+			if number == float64(x+1) {
+				results = append(results, node)
+			}
+		} else if xpathBoolean(value) {
+			results = append(results, node)
+		}
+	}
+	return results, nil
+}
+
+type xpathFilter struct {
+	Primary    xpathExpr
+	Predicates []xpathExpr
+}
+
+func (f xpathFilter) Evaluate(ctx xpathContext) (interface{}, error) {
+	value, value_err := f.Primary.Evaluate(ctx)
+	if value_err != nil {
+		return nil, value_err
+	}
+
+	nodes, is_nodes := value.([]*xpathNode)
+	if !is_nodes {
+		return nil, fmt.Errorf("xpath: predicates can only filter node-sets")
+	}
+	for _, predicate := range f.Predicates {
+		nodes, value_err = applyXpathPredicate(predicate, nodes)
+		if value_err != nil {
+			return nil, value_err
+		}
+	}
+	return nodes, nil
+}
+
+type xpathPath struct {
+	Filter   xpathExpr
+	Absolute bool
+	Steps    []*xpathStep
+}
+
+func (p xpathPath) Evaluate(ctx xpathContext) (interface{}, error) {
+	nodes := []*xpathNode{ctx.Node}
+	if p.Filter != nil {
+		value, value_err := p.Filter.Evaluate(ctx)
+		if value_err != nil {
+			return nil, value_err
+		}
+		filter_nodes, is_nodes := value.([]*xpathNode)
+		if !is_nodes {
+			return nil, fmt.Errorf("xpath: `/` can only follow a node-set")
+		}
+		nodes = filter_nodes
+	} else if p.Absolute {
+		nodes = []*xpathNode{ctx.Node.Document()}
+	}
+
+	for _, step := range p.Steps {
+		var step_err error
+		nodes, step_err = step.Apply(nodes)
+		if step_err != nil {
+			return nil, step_err
+		}
+	}
+	return nodes, nil
+}
+
+//--------------------------------------------------------------------------------
+// XPATH FUNCTIONS
+//--------------------------------------------------------------------------------
+
+type xpathFunctionCall struct {
+	Name      string
+	Arguments []xpathExpr
+}
+
+type xpathFunction struct {
+	MinArgs int
+	MaxArgs int // -1 for variadic
+	Impl    func(ctx xpathContext, args []interface{}) (interface{}, error)
+}
+
+var xpathFunctions map[string]xpathFunction
+
+func init() {
+	xpathFunctions = map[string]xpathFunction{
+		"last": {0, 0, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return float64(ctx.Size), nil
+		}},
+		"position": {0, 0, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return float64(ctx.Position), nil
+		}},
+		"count": {1, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			nodes, nodes_err := xpathNodeSetArgument("count", args[0])
+			return float64(len(nodes)), nodes_err
+		}},
+		"id": {1, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			ids := []string{}
+			if nodes, is_nodes := args[0].([]*xpathNode); is_nodes {
+				for _, node := range nodes {
+					ids = append(ids, strings.Fields(node.StringValue())...)
+				}
+			} else {
+				ids = strings.Fields(xpathString(args[0]))
+			}
+
+			results := []*xpathNode{}
+			for _, node := range appendXpathDescendants(nil, ctx.Node.Document()) {
+				if node.IsElement() && sliceContains(ids, node.Element.Attributes["id"]) {
+					results = append(results, node)
+				}
+			}
+			return results, nil
+		}},
+		"local-name":    {0, 1, xpathNameFunction("local-name")},
+		"name":          {0, 1, xpathNameFunction("name")},
+		"namespace-uri": {0, 1, xpathNameFunction("namespace-uri")},
+		"string": {0, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return xpathString(xpathDefaultArgument(ctx, args)), nil
+		}},
+		"concat": {2, -1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			pieces := []string{}
+			for _, arg := range args {
+				pieces = append(pieces, xpathString(arg))
+			}
+			return strings.Join(pieces, EMPTY), nil
+		}},
+		"starts-with": {2, 2, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return strings.HasPrefix(xpathString(args[0]), xpathString(args[1])), nil
+		}},
+		"contains": {2, 2, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return strings.Contains(xpathString(args[0]), xpathString(args[1])), nil
+		}},
+		"substring-before": {2, 2, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			value, separator := xpathString(args[0]), xpathString(args[1])
+			if index := strings.Index(value, separator); index >= 0 {
+				return value[:index], nil
+			}
+			return EMPTY, nil
+		}},
+		"substring-after": {2, 2, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			value, separator := xpathString(args[0]), xpathString(args[1])
+			if index := strings.Index(value, separator); index >= 0 {
+				return value[index+len(separator):], nil
+			}
+			return EMPTY, nil
+		}},
+		"substring": {2, 3, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			value := []rune(xpathString(args[0]))
+			start := xpathRound(xpathNumber(args[1]))
+			end := math.Inf(1)
+			if len(args) == 3 {
+				end = start + xpathRound(xpathNumber(args[2]))
+			}
+
+			result := []rune{}
+			for x, c := range value {
+				position := float64(x + 1)
+				if position >= start && position < end {
+					result = append(result, c)
+				}
+			}
+			return string(result), nil
+		}},
+		"string-length": {0, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return float64(len([]rune(xpathString(xpathDefaultArgument(ctx, args))))), nil
+		}},
+		"normalize-space": {0, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return strings.Join(strings.FieldsFunc(xpathString(xpathDefaultArgument(ctx, args)), isWhitespace), " "), nil
+		}},
+		"translate": {3, 3, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			from, to := []rune(xpathString(args[1])), []rune(xpathString(args[2]))
+			result := []rune{}
+			for _, c := range xpathString(args[0]) {
+				index := -1
+				for x, from_c := range from {
+					if from_c == c {
+						index = x
+						break
+					}
+				}
+				if index < 0 {
+					result = append(result, c)
+				} else if index < len(to) {
+					result = append(result, to[index])
+				}
+			}
+			return string(result), nil
+		}},
+		"boolean": {1, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return xpathBoolean(args[0]), nil
+		}},
+		"not": {1, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return !xpathBoolean(args[0]), nil
+		}},
+		"true": {0, 0, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return true, nil
+		}},
+		"false": {0, 0, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return false, nil
+		}},
+		"lang": {1, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			lang := strings.ToLower(xpathString(args[0]))
+			for node := ctx.Node; node != nil; node = node.Parent() {
+				if node.IsElement() {
+					if node_lang, has_lang := node.Element.Attributes["lang"]; has_lang {
+						return matchAttributeOperator("|=", strings.ToLower(node_lang), lang), nil
+					}
+				}
+			}
+			return false, nil
+		}},
+		"number": {0, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return xpathNumber(xpathDefaultArgument(ctx, args)), nil
+		}},
+		"sum": {1, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			nodes, nodes_err := xpathNodeSetArgument("sum", args[0])
+			total := 0.0
+			for _, node := range nodes {
+				total += xpathNumber(node.StringValue())
+			}
+			return total, nodes_err
+		}},
+		"floor": {1, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return math.Floor(xpathNumber(args[0])), nil
+		}},
+		"ceiling": {1, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return math.Ceil(xpathNumber(args[0])), nil
+		}},
+		"round": {1, 1, func(ctx xpathContext, args []interface{}) (interface{}, error) {
+			return xpathRound(xpathNumber(args[0])), nil
+		}},
+	}
+}
+
+func (f xpathFunctionCall) Evaluate(ctx xpathContext) (interface{}, error) {
+	function := xpathFunctions[f.Name]
+	args := []interface{}{}
+	for _, argument := range f.Arguments {
+		value, value_err := argument.Evaluate(ctx)
+		if value_err != nil {
+			return nil, value_err
+		}
+		args = append(args, value)
+	}
+	return function.Impl(ctx, args)
+}
+
+func xpathNameFunction(name string) func(ctx xpathContext, args []interface{}) (interface{}, error) {
+	return func(ctx xpathContext, args []interface{}) (interface{}, error) {
+		nodes := []*xpathNode{ctx.Node}
+		if len(args) > 0 {
+			var nodes_err error
+			if nodes, nodes_err = xpathNodeSetArgument(name, args[0]); nodes_err != nil {
+				return nil, nodes_err
+			}
+		}
+		if len(nodes) == 0 || name == "namespace-uri" {
+			return EMPTY, nil
+		}
+		return nodes[0].Name(), nil
+	}
+}
+
+func xpathNodeSetArgument(function string, arg interface{}) ([]*xpathNode, error) {
+	nodes, is_nodes := arg.([]*xpathNode)
+	if !is_nodes {
+		return nil, fmt.Errorf("xpath: %s() expects a node-set", function)
+	}
+	return nodes, nil
+}
+
+func xpathDefaultArgument(ctx xpathContext, args []interface{}) interface{} {
+	if len(args) == 0 {
+		return []*xpathNode{ctx.Node}
+	}
+	return args[0]
+}
+
+//--------------------------------------------------------------------------------
+// XPATH TYPE CONVERSIONS
+//--------------------------------------------------------------------------------
+
+func xpathString(value interface{}) string {
+	switch typed := value.(type) {
+	case string:
+		return typed
+	case bool:
+		if typed {
+			return "true"
+		}
+		return "false"
+	case float64:
+		switch {
+		case math.IsNaN(typed):
+			return "NaN"
+		case math.IsInf(typed, 1):
+			return "Infinity"
+		case math.IsInf(typed, -1):
+			return "-Infinity"
+		case typed == 0:
+			return "0"
+		}
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	case []*xpathNode:
+		if len(typed) == 0 {
+			return EMPTY
+		}
+		return typed[0].StringValue()
+	}
+	return EMPTY
+}
+
+func xpathNumber(value interface{}) float64 {
+	switch typed := value.(type) {
+	case float64:
+		return typed
+	case bool:
+		if typed {
+			return 1
+		}
+		return 0
+	}
+
+	//xpath numbers are only ever `-?digits(.digits?)?` or `-?.digits`, no exponents or leading `+`.
+	text := strings.TrimFunc(xpathString(value), isWhitespace)
+	digits := 0
+	dots := 0
+	for x, c := range text {
+		if c == '-' && x == 0 {
+			continue
+		} else if c == '.' {
+			dots++
+		} else if c >= '0' && c <= '9' {
+			digits++
+		} else {
+			return math.NaN()
+		}
+	}
+	if digits == 0 || dots > 1 {
+		return math.NaN()
+	}
+	number, number_err := strconv.ParseFloat(text, 64)
+	if number_err != nil {
+		return math.NaN()
+	}
+	return number
+}
+
+func xpathBoolean(value interface{}) bool {
+	switch typed := value.(type) {
+	case bool:
+		return typed
+	case float64:
+		return typed != 0 && !math.IsNaN(typed)
+	case string:
+		return len(typed) > 0
+	case []*xpathNode:
+		return len(typed) > 0
+	}
+	return false
+}
+
+func xpathRound(number float64) float64 {
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return number
+	}
+	return math.Floor(number + 0.5)
+}
+
+func xpathCompare(operator string, left, right interface{}) bool {
+	left_nodes, left_is_nodes := left.([]*xpathNode)
+	right_nodes, right_is_nodes := right.([]*xpathNode)
+
+	if left_is_nodes && right_is_nodes {
+		for _, l := range left_nodes {
+			for _, r := range right_nodes {
+				if xpathCompareValues(operator, l.StringValue(), r.StringValue()) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if left_is_nodes || right_is_nodes {
+		nodes, other, flipped := left_nodes, right, false
+		if right_is_nodes {
+			nodes, other, flipped = right_nodes, left, true
+		}
+		if other_bool, is_bool := other.(bool); is_bool {
+			if flipped {
+				return xpathCompareValues(operator, other_bool, len(nodes) > 0)
+			}
+			return xpathCompareValues(operator, len(nodes) > 0, other_bool)
+		}
+		for _, node := range nodes {
+			var node_value interface{} = node.StringValue()
+			if _, is_number := other.(float64); is_number {
+				node_value = xpathNumber(node_value)
+			}
+			if flipped && xpathCompareValues(operator, other, node_value) {
+				return true
+			} else if !flipped && xpathCompareValues(operator, node_value, other) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return xpathCompareValues(operator, left, right)
+}
+
+func xpathCompareValues(operator string, left, right interface{}) bool {
+	if operator == "=" || operator == "!=" {
+		var equal bool
+		_, left_bool := left.(bool)
+		_, right_bool := right.(bool)
+		_, left_number := left.(float64)
+		_, right_number := right.(float64)
+
+		if left_bool || right_bool {
+			equal = xpathBoolean(left) == xpathBoolean(right)
+		} else if left_number || right_number {
+			equal = xpathNumber(left) == xpathNumber(right)
+		} else {
+			equal = xpathString(left) == xpathString(right)
+		}
+
+		if operator == "=" {
+			return equal
+		}
+		return !equal
+	}
+
+	l, r := xpathNumber(left), xpathNumber(right)
+	switch operator {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	return false
+}
+
+//--------------------------------------------------------------------------------
+// XPATH LEXING
+//--------------------------------------------------------------------------------
+
+const (
+	xpathTokenName = iota
+	xpathTokenNodeType
+	xpathTokenFunctionName
+	xpathTokenAxisName
+	xpathTokenOperator
+	xpathTokenNumber
+	xpathTokenLiteral
+	xpathTokenVariable
+	xpathTokenPunctuation
+)
+
+type xpathToken struct {
+	Kind     int
+	Value    string
+	Position int
+}
+
+func lexXpath(query []rune) ([]xpathToken, error) {
+	tokens := []xpathToken{}
+	cursor := 0
+
+	// per the spec, `*` and operator names are only operators when they can't be anything else.
+	can_be_operator := func() bool {
+		if len(tokens) == 0 {
+			return false
+		}
+		last := tokens[len(tokens)-1]
+		if last.Kind == xpathTokenOperator {
+			return false
+		}
+		return !(last.Kind == xpathTokenPunctuation && (last.Value == "@" || last.Value == "::" || last.Value == "(" || last.Value == "[" || last.Value == ","))
+	}
+
+	for {
+		readWhitespace(query, &cursor)
+		if cursor >= len(query) {
+			return tokens, nil
+		}
+
+		start := cursor
+		c := query[cursor]
+		next := rune(0)
+		if cursor+1 < len(query) {
+			next = query[cursor+1]
+		}
+
+		switch {
+		case c == '(' || c == ')' || c == '[' || c == ']' || c == '@' || c == ',':
+			tokens = append(tokens, xpathToken{xpathTokenPunctuation, string(c), start})
+			cursor++
+		case c == ':' && next == ':':
+			tokens = append(tokens, xpathToken{xpathTokenPunctuation, "::", start})
+			cursor += 2
+		case c == '.' && next == '.':
+			tokens = append(tokens, xpathToken{xpathTokenPunctuation, "..", start})
+			cursor += 2
+		case c == '.' && !(next >= '0' && next <= '9'):
+			tokens = append(tokens, xpathToken{xpathTokenPunctuation, ".", start})
+			cursor++
+		case c == '/' && next == '/':
+			tokens = append(tokens, xpathToken{xpathTokenOperator, "//", start})
+			cursor += 2
+		case c == '!' && next == '=', c == '<' && next == '=', c == '>' && next == '=':
+			tokens = append(tokens, xpathToken{xpathTokenOperator, string(query[cursor : cursor+2]), start})
+			cursor += 2
+		case strings.ContainsRune("/|+-=<>", c):
+			tokens = append(tokens, xpathToken{xpathTokenOperator, string(c), start})
+			cursor++
+		case c == '*':
+			if can_be_operator() {
+				tokens = append(tokens, xpathToken{xpathTokenOperator, "*", start})
+			} else {
+				tokens = append(tokens, xpathToken{xpathTokenName, "*", start})
+			}
+			cursor++
+		case c == '"' || c == '\'':
+			end := strings.IndexRune(string(query[cursor+1:]), c)
+			if end < 0 {
+				return nil, xpathError(query, start, "unterminated string literal")
+			}
+			literal := []rune(string(query[cursor+1:])[:end])
+			tokens = append(tokens, xpathToken{xpathTokenLiteral, string(literal), start})
+			cursor += len(literal) + 2
+		case (c >= '0' && c <= '9') || c == '.':
+			for cursor < len(query) && ((query[cursor] >= '0' && query[cursor] <= '9') || query[cursor] == '.') {
+				cursor++
+			}
+			tokens = append(tokens, xpathToken{xpathTokenNumber, string(query[start:cursor]), start})
+		case c == '$':
+			cursor++
+			name := readXpathName(query, &cursor)
+			if len(name) == 0 {
+				return nil, xpathError(query, start, "expected a variable name after `$`")
+			}
+			tokens = append(tokens, xpathToken{xpathTokenVariable, name, start})
+		case isXpathNameStart(c):
+			name := readXpathName(query, &cursor)
+			if can_be_operator() {
+				if name != "and" && name != "or" && name != "mod" && name != "div" {
+					return nil, xpathError(query, start, "unexpected name `%s`", name)
+				}
+				tokens = append(tokens, xpathToken{xpathTokenOperator, name, start})
+				break
+			}
+
+			lookahead := cursor
+			readWhitespace(query, &lookahead)
+			switch {
+			case lookahead < len(query) && query[lookahead] == '(':
+				if name == XPATH_NODE_TEST_NODE || name == XPATH_NODE_TEST_TEXT || name == XPATH_NODE_TEST_COMMENT || name == XPATH_NODE_TEST_PI {
+					tokens = append(tokens, xpathToken{xpathTokenNodeType, name, start})
+				} else {
+					tokens = append(tokens, xpathToken{xpathTokenFunctionName, name, start})
+				}
+			case lookahead+1 < len(query) && query[lookahead] == ':' && query[lookahead+1] == ':':
+				tokens = append(tokens, xpathToken{xpathTokenAxisName, name, start})
+			default:
+				tokens = append(tokens, xpathToken{xpathTokenName, name, start})
+			}
+		default:
+			return nil, xpathError(query, start, "unexpected character %q", c)
+		}
+	}
+}
+
+// readXpathName reads an NCName, a QName, or a `prefix:*` name test.
+func readXpathName(query []rune, cursor *int) string {
+	start := *cursor
+	for *cursor < len(query) && isXpathNameCharacter(query[*cursor]) {
+		*cursor++
+	}
+	if *cursor+1 < len(query) && query[*cursor] == ':' && query[*cursor+1] != ':' {
+		if query[*cursor+1] == '*' {
+			*cursor += 2
+		} else if isXpathNameStart(query[*cursor+1]) {
+			*cursor++
+			for *cursor < len(query) && isXpathNameCharacter(query[*cursor]) {
+				*cursor++
+			}
+		}
+	}
+	return string(query[start:*cursor])
+}
+
+func isXpathNameStart(c rune) bool {
+	return c == '_' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isXpathNameCharacter(c rune) bool {
+	return isXpathNameStart(c) || c == '-' || c == '.' || (c >= '0' && c <= '9')
+}
+
+func xpathError(query []rune, cursor int, format string, args ...interface{}) error {
+	return fmt.Errorf("invalid xpath `%s`: %s at column %d", string(query), fmt.Sprintf(format, args...), cursor+1)
+}
+
+//--------------------------------------------------------------------------------
+// XPATH PARSING
+//--------------------------------------------------------------------------------
+
+type xpathParser struct {
+	Query  []rune
+	Tokens []xpathToken
+	Index  int
+}
+
+func parseXpath(query string) (xpathExpr, error) {
+	query_runes := []rune(query)
+	tokens, lex_err := lexXpath(query_runes)
+	if lex_err != nil {
+		return nil, lex_err
+	}
+
+	parser := &xpathParser{Query: query_runes, Tokens: tokens}
+	expr, expr_err := parser.parseOr()
+	if expr_err != nil {
+		return nil, expr_err
+	}
+	if parser.Index < len(tokens) {
+		return nil, parser.errorf("unexpected `%s`", tokens[parser.Index].Value)
+	}
+	return expr, nil
+}
+
+func (p *xpathParser) peek() *xpathToken {
+	if p.Index < len(p.Tokens) {
+		return &p.Tokens[p.Index]
+	}
+	return nil
+}
+
+func (p *xpathParser) peekIs(kind int, values ...string) bool {
+	token := p.peek()
+	if token == nil || token.Kind != kind {
+		return false
+	}
+	return len(values) == 0 || sliceContains(values, token.Value)
+}
+
+func (p *xpathParser) expect(kind int, value string) error {
+	if !p.peekIs(kind, value) {
+		return p.errorf("expected `%s`", value)
+	}
+	p.Index++
+	return nil
+}
+
+func (p *xpathParser) errorf(format string, args ...interface{}) error {
+	position := len(p.Query)
+	if token := p.peek(); token != nil {
+		position = token.Position
+	}
+	return xpathError(p.Query, position, format, args...)
+}
+
+func (p *xpathParser) parseBinary(operators []string, next func() (xpathExpr, error)) (xpathExpr, error) {
+	left, left_err := next()
+	if left_err != nil {
+		return nil, left_err
+	}
+	for p.peekIs(xpathTokenOperator, operators...) {
+		operator := p.peek().Value
+		p.Index++
+		right, right_err := next()
+		if right_err != nil {
+			return nil, right_err
+		}
+		left = xpathBinary{Operator: operator, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *xpathParser) parseOr() (xpathExpr, error) {
+	return p.parseBinary([]string{"or"}, p.parseAnd)
+}
+
+func (p *xpathParser) parseAnd() (xpathExpr, error) {
+	return p.parseBinary([]string{"and"}, p.parseEquality)
+}
+
+func (p *xpathParser) parseEquality() (xpathExpr, error) {
+	return p.parseBinary([]string{"=", "!="}, p.parseRelational)
+}
+
+func (p *xpathParser) parseRelational() (xpathExpr, error) {
+	return p.parseBinary([]string{"<", "<=", ">", ">="}, p.parseAdditive)
+}
+
+func (p *xpathParser) parseAdditive() (xpathExpr, error) {
+	return p.parseBinary([]string{"+", "-"}, p.parseMultiplicative)
+}
+
+func (p *xpathParser) parseMultiplicative() (xpathExpr, error) {
+	return p.parseBinary([]string{"*", "div", "mod"}, p.parseUnary)
+}
+
+func (p *xpathParser) parseUnary() (xpathExpr, error) {
+	if p.peekIs(xpathTokenOperator, "-") {
+		p.Index++
+		operand, operand_err := p.parseUnary()
+		if operand_err != nil {
+			return nil, operand_err
+		}
+		return xpathNegate{Operand: operand}, nil
+	}
+	return p.parseBinary([]string{"|"}, p.parsePath)
+}
+
+func (p *xpathParser) parsePath() (xpathExpr, error) {
+	token := p.peek()
+	if token == nil {
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	is_filter := token.Kind == xpathTokenLiteral || token.Kind == xpathTokenNumber || token.Kind == xpathTokenVariable ||
+		token.Kind == xpathTokenFunctionName || (token.Kind == xpathTokenPunctuation && token.Value == "(")
+	if !is_filter {
+		return p.parseLocationPath()
+	}
+
+	primary, primary_err := p.parsePrimary()
+	if primary_err != nil {
+		return nil, primary_err
+	}
+	predicates, predicates_err := p.parsePredicates()
+	if predicates_err != nil {
+		return nil, predicates_err
+	}
+
+	var filter xpathExpr = primary
+	if len(predicates) > 0 {
+		filter = xpathFilter{Primary: primary, Predicates: predicates}
+	}
+
+	if !p.peekIs(xpathTokenOperator, "/", "//") {
+		return filter, nil
+	}
+	path := xpathPath{Filter: filter}
+	steps_err := p.parseRelativeSteps(&path)
+	return path, steps_err
+}
+
+func (p *xpathParser) parseLocationPath() (xpathExpr, error) {
+	path := xpathPath{}
+	if p.peekIs(xpathTokenOperator, "/") {
+		path.Absolute = true
+		p.Index++
+		if !p.isStepStart() {
+			return path, nil
+		}
+	} else if p.peekIs(xpathTokenOperator, "//") {
+		path.Absolute = true
+		p.Index++
+		path.Steps = append(path.Steps, &xpathStep{Axis: XPATH_AXIS_DESCENDANT_OR_SELF, NodeTest: XPATH_NODE_TEST_NODE})
+	}
+
+	step, step_err := p.parseStep()
+	if step_err != nil {
+		return nil, step_err
+	}
+	path.Steps = append(path.Steps, step)
+	steps_err := p.parseRelativeSteps(&path)
+	return path, steps_err
+}
+
+func (p *xpathParser) parseRelativeSteps(path *xpathPath) error {
+	for p.peekIs(xpathTokenOperator, "/", "//") {
+		if p.peek().Value == "//" {
+			path.Steps = append(path.Steps, &xpathStep{Axis: XPATH_AXIS_DESCENDANT_OR_SELF, NodeTest: XPATH_NODE_TEST_NODE})
+		}
+		p.Index++
+		step, step_err := p.parseStep()
+		if step_err != nil {
+			return step_err
+		}
+		path.Steps = append(path.Steps, step)
+	}
+	return nil
+}
+
+func (p *xpathParser) isStepStart() bool {
+	token := p.peek()
+	if token == nil {
+		return false
+	}
+	switch token.Kind {
+	case xpathTokenName, xpathTokenNodeType, xpathTokenAxisName:
+		return true
+	case xpathTokenPunctuation:
+		return token.Value == "." || token.Value == ".." || token.Value == "@"
+	}
+	return false
+}
+
+func (p *xpathParser) parseStep() (*xpathStep, error) {
+	if p.peekIs(xpathTokenPunctuation, ".") {
+		p.Index++
+		return &xpathStep{Axis: XPATH_AXIS_SELF, NodeTest: XPATH_NODE_TEST_NODE}, nil
+	}
+	if p.peekIs(xpathTokenPunctuation, "..") {
+		p.Index++
+		return &xpathStep{Axis: XPATH_AXIS_PARENT, NodeTest: XPATH_NODE_TEST_NODE}, nil
+	}
+
+	step := &xpathStep{Axis: XPATH_AXIS_CHILD}
+	if p.peekIs(xpathTokenPunctuation, "@") {
+		p.Index++
+		step.Axis = XPATH_AXIS_ATTRIBUTE
+	} else if p.peekIs(xpathTokenAxisName) {
+		step.Axis = p.peek().Value
+		if !isXpathAxis(step.Axis) {
+			return nil, p.errorf("unknown axis `%s`", step.Axis)
+		}
+		p.Index++
+		if err := p.expect(xpathTokenPunctuation, "::"); err != nil {
+			return nil, err
+		}
+	}
+
+	token := p.peek()
+	if token == nil {
+		return nil, p.errorf("expected a node test")
+	}
+	switch token.Kind {
+	case xpathTokenName:
+		step.NodeTest = XPATH_NODE_TEST_NAME
+		step.Name = token.Value
+		p.Index++
+	case xpathTokenNodeType:
+		step.NodeTest = token.Value
+		p.Index++
+		if err := p.expect(xpathTokenPunctuation, "("); err != nil {
+			return nil, err
+		}
+		if step.NodeTest == XPATH_NODE_TEST_PI && p.peekIs(xpathTokenLiteral) {
+			step.Name = p.Tokens[p.Index].Value
+			p.Index++
+		}
+		if err := p.expect(xpathTokenPunctuation, ")"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.errorf("expected a node test, found `%s`", token.Value)
+	}
+
+	predicates, predicates_err := p.parsePredicates()
+	step.Predicates = predicates
+	return step, predicates_err
+}
+
+func (p *xpathParser) parsePredicates() ([]xpathExpr, error) {
+	predicates := []xpathExpr{}
+	for p.peekIs(xpathTokenPunctuation, "[") {
+		p.Index++
+		predicate, predicate_err := p.parseOr()
+		if predicate_err != nil {
+			return nil, predicate_err
+		}
+		if err := p.expect(xpathTokenPunctuation, "]"); err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, predicate)
+	}
+	return predicates, nil
+}
+
+func (p *xpathParser) parsePrimary() (xpathExpr, error) {
+	token := p.peek()
+	switch token.Kind {
+	case xpathTokenLiteral:
+		p.Index++
+		return xpathLiteral{Value: token.Value}, nil
+	case xpathTokenNumber:
+		p.Index++
+		number, number_err := strconv.ParseFloat(token.Value, 64)
+		if number_err != nil {
+			return nil, xpathError(p.Query, token.Position, "invalid number `%s`", token.Value)
+		}
+		return xpathLiteral{Value: number}, nil
+	case xpathTokenVariable:
+		return nil, p.errorf("variable references are not supported")
+	case xpathTokenFunctionName:
+		return p.parseFunctionCall()
+	}
+
+	p.Index++ // (
+	expr, expr_err := p.parseOr()
+	if expr_err != nil {
+		return nil, expr_err
+	}
+	return expr, p.expect(xpathTokenPunctuation, ")")
+}
+
+func (p *xpathParser) parseFunctionCall() (xpathExpr, error) {
+	token := p.peek()
+	function, has_function := xpathFunctions[token.Value]
+	if !has_function {
+		return nil, p.errorf("unknown function `%s()`", token.Value)
+	}
+	p.Index += 2 // name (
+
+	call := xpathFunctionCall{Name: token.Value}
+	for !p.peekIs(xpathTokenPunctuation, ")") {
+		if len(call.Arguments) > 0 {
+			if err := p.expect(xpathTokenPunctuation, ","); err != nil {
+				return nil, err
+			}
+		}
+		argument, argument_err := p.parseOr()
+		if argument_err != nil {
+			return nil, argument_err
+		}
+		call.Arguments = append(call.Arguments, argument)
+	}
+	p.Index++ // )
+
+	if len(call.Arguments) < function.MinArgs || (function.MaxArgs >= 0 && len(call.Arguments) > function.MaxArgs) {
+		return nil, xpathError(p.Query, token.Position, "wrong number of arguments to `%s()`", token.Value)
+	}
+	return call, nil
+}
+
+func isXpathAxis(axis string) bool {
+	switch axis {
+	case XPATH_AXIS_ANCESTOR, XPATH_AXIS_ANCESTOR_OR_SELF, XPATH_AXIS_ATTRIBUTE, XPATH_AXIS_CHILD,
+		XPATH_AXIS_DESCENDANT, XPATH_AXIS_DESCENDANT_OR_SELF, XPATH_AXIS_FOLLOWING, XPATH_AXIS_FOLLOWING_SIBLING,
+		XPATH_AXIS_NAMESPACE, XPATH_AXIS_PARENT, XPATH_AXIS_PRECEDING, XPATH_AXIS_PRECEDING_SIBLING, XPATH_AXIS_SELF:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package html
+
+import (
+	"testing"
+)
+
+const XPATH_DOC = `
+<html>
+	<body>
+		<div id="main" class="container">
+			<h1>  Hello   World  </h1>
+			<ul>
+				<li class="item">One</li>
+				<li class="item selected">Two</li>
+				<li class="item">Three</li>
+			</ul>
+			<a href="/one">First link</a>
+			<a href="http://example.com/two">Second link</a>
+			<!-- a comment -->
+		</div>
+		<div id="footer"><span>Price: 12.5</span><span>7.5</span></div>
+	</body>
+</html>`
+
+func TestQueryXpath(t *testing.T) {
+	doc, parse_err := Parse(XPATH_DOC)
+	if parse_err != nil {
+		t.Error(parse_err.Error())
+		t.FailNow()
+	}
+
+	test_cases := map[string]int{
+		"/html/body/div":                                2,
+		"//li":                                          3,
+		"//ul/li[2]":                                    1,
+		"//li[last()]":                                  1,
+		"//li[position() < 3]":                          2,
+		"//li[@class='item']":                           2,
+		"//li[contains(@class, 'selected')]":            1,
+		"//a[starts-with(@href, 'http')]":               1,
+		"//h1[normalize-space() = 'Hello World']":       1,
+		"//h1[normalize-space(text()) = 'Hello World']": 1,
+		"//li/text()":                                   3,
+		"//ul[count(li) = 3]":                           1,
+		"//ul[count(li) > 3]":                           0,
+		"//li[2]/following-sibling::li":                 1,
+		"//li[3]/preceding-sibling::li":                 2,
+		"//li[3]/preceding-sibling::li[1]":              1,
+		"//li[1]/parent::ul":                            1,
+		"//li[1]/ancestor::div":                         1,
+		"//li[1]/ancestor-or-self::*":                   5,
+		"//ul/descendant::text()":                       7,
+		"//h1/following::a":                             2,
+		"//a[1]/preceding::li":                          3,
+		"//a/@href":                                     2,
+		"//@id":                                         2,
+		"//div[@id='main']/self::div":                   1,
+		"//div[@id='main']/comment()":                   1,
+		"//div[@id='main']/*":                           4,
+		"//li | //a":                                    5,
+		"(//li)[1]":                                     1,
+		"//div[span]":                                   1,
+		"//div[not(span)]":                              1,
+		"//li[. = 'Two']/..":                            1,
+		"//*[@id]":                                      2,
+		"id('footer')/span":                             2,
+		"//li[string-length(.) = 3]":                    2,
+		"//li[substring(., 1, 2) = 'Tw']":               1,
+		"//li[translate(., 'OT', 'ot') = 'one']":        1,
+		"//a[substring-after(@href, '://') = 'example.com/two']": 1,
+		"//a[substring-before(@href, ':') = 'http']":             1,
+		"//div[sum(span[2]) = 7.5]":                              1,
+		"//li[position() mod 2 = 1]":                             2,
+		"//li[name() = 'li'][1]":                                 1,
+		"//processing-instruction()":                             0,
+	}
+
+	for query, expected := range test_cases {
+		results, query_err := doc.QueryXpath(query)
+		if query_err != nil {
+			t.Errorf("%s: %s", query, query_err.Error())
+			t.FailNow()
+		}
+		if len(results) != expected {
+			t.Errorf("QueryXpath(%q) count is %d, expected %d", query, len(results), expected)
+		}
+	}
+}
+
+func TestQueryXpathResults(t *testing.T) {
+	doc, _ := Parse(XPATH_DOC)
+
+	hrefs, query_err := doc.QueryXpath("//a/@href")
+	if query_err != nil {
+		t.Error(query_err.Error())
+		t.FailNow()
+	}
+	if len(hrefs) != 2 || hrefs[0].SourceHTML != "/one" || hrefs[1].SourceHTML != "http://example.com/two" {
+		t.Error("attribute nodes were not returned in document order")
+		t.FailNow()
+	}
+
+	ancestors, _ := doc.QueryXpath("//li[1]/ancestor::*[1]")
+	if len(ancestors) != 1 || ancestors[0].ElementName != ELEMENT_UL {
+		t.Error("reverse axis predicates should count from the context node outward")
+		t.FailNow()
+	}
+
+	uls := doc.GetElementsByTagName(ELEMENT_UL)
+	items, query_err := uls[0].QueryXpath("li[@class='item selected']/following-sibling::*")
+	if query_err != nil {
+		t.Error(query_err.Error())
+		t.FailNow()
+	}
+	if len(items) != 1 || items[0].GetInnerText() != "Three" {
+		t.Error("relative xpath from a nested element returned the wrong results")
+		t.FailNow()
+	}
+}
+
+func TestQueryXpathString(t *testing.T) {
+	doc, _ := Parse(XPATH_DOC)
+
+	test_cases := map[string]string{
+		"count(//li)":                      "3",
+		"string(//a[2]/@href)":             "http://example.com/two",
+		"concat('a', 'b', 'c')":            "abc",
+		"1 + 2 * 3":                        "7",
+		"10 div 4":                         "2.5",
+		"-(3 - 5)":                         "2",
+		"round(2.5)":                       "3",
+		"floor(-1.5)":                      "-2",
+		"ceiling(1.2)":                     "2",
+		"number('abc')":                    "NaN",
+		"1 div 0":                          "Infinity",
+		"boolean(//table)":                 "false",
+		"//li[1] = 'One'":                  "true",
+		"//li != 'One'":                    "true",
+		"true() and not(false())":          "true",
+		"name(//*[@id='footer'])":          "div",
+		"local-name(//a/@href)":            "href",
+		"sum(//span[2])":                   "7.5",
+		"normalize-space(//h1)":            "Hello World",
+		"string(//li[@class='item'][2])":   "Three",
+		"count(//div[@id='main']/node())":  "11",
+		"count(//div[@id='main']/*)":       "4",
+		"string-length(normalize-space())": "63",
+	}
+
+	for query, expected := range test_cases {
+		result, query_err := doc.QueryXpathString(query)
+		if query_err != nil {
+			t.Errorf("%s: %s", query, query_err.Error())
+			t.FailNow()
+		}
+		if result != expected {
+			t.Errorf("QueryXpathString(%q) is %q, expected %q", query, result, expected)
+		}
+	}
+}
+
+func TestQueryXpathInvalid(t *testing.T) {
+	doc, _ := Parse(XPATH_DOC)
+
+	invalid := []string{
+		"",
+		"//",
+		"//li[",
+		"//li[1",
+		"//li)",
+		"bogus::li",
+		"//li[unknown()]",
+		"count()",
+		"'unterminated",
+		"$var",
+		"//li#",
+		"count(//li)",
+	}
+
+	for _, query := range invalid {
+		if _, query_err := doc.QueryXpath(query); query_err == nil {
+			t.Errorf("QueryXpath(%q) should have errored", query)
+		}
+	}
+}
+
+func TestQueryXpathAfterChanges(t *testing.T) {
+	doc, _ := Parse(XPATH_DOC)
+	ul := doc.GetElementsByTagName(ELEMENT_UL)[0]
+	if items, _ := ul.QueryXpath("li"); len(items) != 3 {
+		t.Errorf("found %d items", len(items))
+	}
+
+	li := &Element{ElementName: ELEMENT_LI, Attributes: map[string]string{}}
+	ul.AddChild(li)
+	li.SetAttr("class", "added")
+	ul.FirstChild.NextSibling.Attributes["title"] = "set directly"
+	if items, _ := ul.QueryXpath("li"); len(items) != 4 || items[3] != li {
+		t.Error("a query should see a child added after the last one")
+	}
+	if added, _ := doc.QueryXpath("//li[@class='added']/preceding-sibling::li[@title]"); len(added) != 1 {
+		t.Error("a query should see attributes changed after the last one")
+	}
+
+	node := newXpathDocument(ul)
+	expr, _ := parseXpath("li[2]/following-sibling::li")
+	if value, _ := expr.Evaluate(xpathContext{Node: node, Position: 1, Size: 1}); len(value.([]*xpathNode)) != 2 {
+		t.Error("relative query from a nested element returned the wrong results")
+	}
+	if all, _ := doc.QueryXpath("//node()"); len(node.document.nodes) >= len(all) {
+		t.Errorf("a relative query shouldn't visit the whole document, it made %d of %d nodes", len(node.document.nodes), len(all))
+	}
+
+	ul.Detach()
+	if items, _ := ul.QueryXpath("/ul/li"); len(items) != 4 {
+		t.Errorf("a detached element should be the top of its own document, found %d items", len(items))
+	}
+}